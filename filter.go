@@ -4,24 +4,37 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/gob"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kljensen/snowball/english"
 )
 
-const (
-	dictPath = "/usr/share/dict/words"
-	freqPath = "./freq2.txt"
-)
+// dictCachePath is where loadDict caches the stemmed dictionary.
+const dictCachePath = "./dict_stems.gob"
+
+var dictPath = flag.String("dict", "/usr/share/dict/words", "path to the dictionary word list")
+var freqPath = flag.String("freq", "./freq2.txt", "path to the word-frequency list to filter")
+var wordLen = flag.Int("len", 5, "length of the words to keep")
+var outPath = flag.String("out", "", "path to write the filtered word-frequency list; standard output if empty")
 
 func main() {
-	dict := loadDict()
-	data, err := ioutil.ReadFile(freqPath)
+	flag.Parse()
+	dict, err := loadDict()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	data, err := ioutil.ReadFile(*freqPath)
 	if err != nil {
 		fmt.Printf("failed to read frequency file: %s", err)
 		os.Exit(1)
@@ -44,9 +57,9 @@ func main() {
 				fmt.Printf("failed to parse frequency: %s", err)
 				os.Exit(1)
 			}
-			if len(freqWord) == 5 {
+			if len(freqWord) == *wordLen {
 				freq[freqWord] = freq[freqWord] + f
-			} else if len(dictWord) == 5 {
+			} else if len(dictWord) == *wordLen {
 				freq[dictWord] = freq[dictWord] + f
 			}
 		}
@@ -62,16 +75,126 @@ func main() {
 	sort.Slice(sorted, func(i, j int) bool {
 		return freq[sorted[i]] > freq[sorted[j]]
 	})
-	for _, w := range sorted {
-		fmt.Println(w, freq[w])
+	if err := writeOutput(sorted, freq); err != nil {
+		fmt.Printf("failed to write output: %s\n", err)
+		os.Exit(1)
 	}
 }
 
-func loadDict() map[string]string {
-	data, err := ioutil.ReadFile(dictPath)
+// writeOutput writes the sorted words and their frequencies
+// to -out, or to standard output if it's empty.
+// The output file is only replaced once it is completely written,
+// so it may be the same as an input file.
+func writeOutput(sorted []string, freq map[string]int) error {
+	if *outPath == "" {
+		return writeFreqs(os.Stdout, sorted, freq)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(*outPath), filepath.Base(*outPath)+".tmp")
 	if err != nil {
-		fmt.Printf("failed to read dictionary file: %s", err)
-		os.Exit(1)
+		return err
+	}
+	// TempFile creates the file readable only by its owner.
+	err = f.Chmod(0644)
+	if err == nil {
+		err = writeFreqs(f, sorted, freq)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), *outPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// writeFreqs writes the sorted words and their frequencies to out.
+func writeFreqs(out io.Writer, sorted []string, freq map[string]int) error {
+	w := bufio.NewWriter(out)
+	for _, word := range sorted {
+		fmt.Fprintln(w, word, freq[word])
+	}
+	return w.Flush()
+}
+
+// dictCache is the cached result of stemming a dictionary file.
+// It is valid if the file's path, modification time, and size
+// and the word length are unchanged.
+type dictCache struct {
+	Path    string
+	Len     int
+	ModTime time.Time
+	Size    int64
+	Dict    map[string]string
+}
+
+// loadDict returns a map from stems to dictionary words.
+// Stemming the dictionary is slow, so the result is cached in dictCachePath.
+func loadDict() (map[string]string, error) {
+	info, err := os.Stat(*dictPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary file: %w", err)
+	}
+	if dict, ok := readDictCache(info); ok {
+		return dict, nil
+	}
+	dict, err := stemDict()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDictCache(info, dict); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write dictionary cache: %s\n", err)
+	}
+	return dict, nil
+}
+
+// readDictCache returns the cached stemmed dictionary
+// and whether it is valid for the dictionary file described by info.
+func readDictCache(info os.FileInfo) (map[string]string, bool) {
+	f, err := os.Open(dictCachePath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var cache dictCache
+	if err := gob.NewDecoder(f).Decode(&cache); err != nil {
+		return nil, false
+	}
+	if cache.Path != *dictPath || cache.Len != *wordLen ||
+		!cache.ModTime.Equal(info.ModTime()) || cache.Size != info.Size() {
+		return nil, false
+	}
+	return cache.Dict, true
+}
+
+// writeDictCache writes dict to the cache for the dictionary file described by info.
+func writeDictCache(info os.FileInfo, dict map[string]string) error {
+	f, err := os.Create(dictCachePath)
+	if err != nil {
+		return err
+	}
+	cache := dictCache{
+		Path:    *dictPath,
+		Len:     *wordLen,
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Dict:    dict,
+	}
+	if err := gob.NewEncoder(f).Encode(cache); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stemDict returns a map from stems to the words in the dictionary file,
+// preferring words of length -len.
+func stemDict() (map[string]string, error) {
+	data, err := ioutil.ReadFile(*dictPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary file: %w", err)
 	}
 	dict := make(map[string]string, 4096)
 	scanner := bufio.NewScanner(bytes.NewReader(data))
@@ -83,13 +206,12 @@ func loadDict() map[string]string {
 			continue
 		}
 		stem := english.Stem(w, true)
-		if prev, ok := dict[stem]; !ok || len(prev) != 5 {
+		if prev, ok := dict[stem]; !ok || len(prev) != *wordLen {
 			dict[stem] = w
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		fmt.Printf("error reading dictionary file: %s", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error reading dictionary file: %w", err)
 	}
-	return dict
+	return dict, nil
 }
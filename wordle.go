@@ -3,322 +3,3521 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"container/list"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-// freqListPath is the path to a list of word-frequency pairs,
+// freqListPath is the default path to a list of word-frequency pairs,
 // one pair per-line, separated by space.
 const freqListPath = "./freq2_filtered_dedup.txt"
 
 // smallSetSize is the size threshold to consider a candidate set size small.
 // For small candidate sets, compute expected next-set size for all words.
-const smallSetSize = 500
+var smallSetSize = flag.Int("fullset", 500, "compute the expected next-set size for every candidate when there are at most `N` candidates")
+
+// puzzleAnswers are the answers to the NYT puzzles,
+// indexed by puzzle number, for the -puzzle flag.
+// No answer list is bundled, so it is empty.
+var puzzleAnswers []string
+
+// maxTurns is the number of guesses allowed in a game.
+const maxTurns = 6
+
+var startTurn = flag.Int("turn", 1, "the number of the first guess in interactive mode, for a game already under way")
+var maxGuesses = flag.Int("max-guesses", maxTurns, "the number of guesses allowed in a game; 0 means no limit")
 
 // topSetSize is number of candidates for which
 // to compute the full expected next-set size
 // if the total candidate list is larger than smallSetSize.
-const topSetSize = 20
+var topSetSize = flag.Int("topn", 20, "number of top-scoring candidates for which to compute the expected next-set size when there are many candidates")
+
+// exactSetSize is the size threshold to consider a candidate set tiny.
+// For tiny candidate sets, search for the guess that finishes soonest.
+var exactSetSize = flag.Int("exact", 8, "searches exhaustively for the guess that finishes in the fewest turns when there are at most `N` candidates, falling back to -score if the search takes too long; 0 disables")
 
-var answer = flag.String("answer", "", "simulates play to find the specified answer")
+var answer = flag.String("answer", "", "simulates play to find the specified answer, or each of a comma-separated list of answers")
+var puzzle = flag.Int("puzzle", -1, "simulates play to find the answer to NYT puzzle number `N`")
 var verbose = flag.Bool("v", false, "verbose printing when simulating play")
+var compact = flag.Bool("compact", false, "prints constraints on a single line with -v")
+var replayPath = flag.String("replay", "", "applies each line of feedback in the `file`, printing the candidates left and best guess after each")
+var outputPath = flag.String("output-candidates", "", "writes the remaining candidates and their frequencies to the `file` each time suggestions are made, and with -lookup")
+var selfcheck = flag.Bool("selfcheck", false, "checks that the answer satisfies the constraints from each simulated guess, reporting the first violation")
+var logPath = flag.String("log", "", "writes a JSON record of each simulated guess to the `file`")
+var confirm = flag.Bool("confirm", false, "keeps playing when one candidate remains, to confirm it with its feedback")
+var minConfidence = flag.Float64("min-confidence", 0.5, "feedback tiles entered with a lower :confidence flag candidates instead of eliminating them")
+var strictGrey = flag.Bool("strict-grey", false, "a - tile means the letter is not in the answer at all, as in clones that mark every copy of a letter in the answer ~ or +; NYT Wordle, and clones that follow its rules, like Absurdle, instead mark - the copies beyond those in the answer")
+var yellowExcludes = flag.Bool("yellow-excludes-position", true, "a ~ tile rules its letter out of its position; set to false for clones that don't guarantee that")
+var strict = flag.Bool("strict", false, "refuses feedback that contradicts feedback from earlier turns")
+var trajectory = flag.Bool("trajectory", false, "prints the number of candidates before each guess of a simulated game")
+var resultFormat = flag.String("result-format", "human", "format of simulation results: human or json")
 var guess0 = flag.String("guess0", "", "first guess to try when simulating play")
+var freqFiles = flag.String("freq", freqListPath, "comma-separated word-frequency files to merge, each optionally suffixed with :weight")
+var minFreq = flag.Int("minfreq", 0, "drops candidate words with a frequency below `N`")
+var allowedPath = flag.String("allowed", "", "a `file` of the words the game accepts as guesses; other candidates are suggested last")
+var dropJunk = flag.Bool("drop-junk", false, "drops candidate words that look like junk: with no vowels or with a letter 4 or more times")
+var validate = flag.Bool("validate", false, "reports on the lines of the -freq files and exits, with failure if any have parse errors")
+var noFreqFile = flag.Bool("nofreq-file", false, "reads the -freq files as plain word lists, giving each word frequency 1; this is detected for files with a single word on every line")
+var freqFormat = flag.String("format", "auto", "format of the -freq files: csv, tsv, ssv (space-separated), or auto to detect from the first line")
+var symAbsent = flag.String("sym-absent", "-", "the symbol for a wrong letter in feedback")
+var symPresent = flag.String("sym-present", "~", "the symbol for a letter in a different position in feedback")
+var symCorrect = flag.String("sym-green", "+", "the symbol for a correct letter in feedback")
+var alphabetSpec = flag.String("alphabet", defaultAlphabet, "the letters that can appear in words, or auto to use every lower-case letter in the -freq files")
+var secret = flag.String("secret", "", "the answer used to compute feedback for the interactive guess command")
+var lookup = flag.Bool("lookup", false, "prints the words consistent with -known by frequency and exits")
+var known = flag.String("known", "", "with -lookup, comma-separated feedback lines, like \"-r -a -i ~s +e\", and patterns, like \"_r_ne\"")
+var best = flag.Bool("best", false, "prints the best opening guess and exits")
+var absurdle = flag.Bool("absurdle", false, "simulates play against an adversarial answer")
+var randomOpener = flag.Int("randomize-opener", 0, "opens with a word chosen at random from the top `K`, for variety")
+var sample = flag.Int("sample", 0, "estimates the expected next-set size from a random sample of `K` answers; 0 means all")
+var seed = flag.Int64("seed", 1, "random seed for -sample, and for -randomize-opener, which otherwise is seeded by the time to vary between runs")
+var explain = flag.Bool("explain", false, "explains the choice of the most preferred suggestion")
+var probability = flag.Bool("probability", false, "prints each suggestion's chance of being the answer: its share of the candidates' total frequency")
+var confidenceSize = flag.Int("confidence", 10, "prints the chance that the most preferred suggestion is the answer when there are at most `N` candidates; 0 disables")
+var preferAnswers = flag.Bool("prefer-answers", false, "with -disambiguate, prefers a remaining candidate to a guess that can't be the answer with the same worst-case next-set size")
+var disambiguate = flag.Bool("disambiguate", false, "also suggests the word from the whole list that best separates the remaining candidates, even if it can't be the answer")
+var cacheSize = flag.Int("cache", 16, "the number of recent game states whose sorted candidates are kept in interactive mode; 0 disables")
+var showGuesses = flag.Bool("guesses", false, "prints a rough estimate of the guesses left to find the answer with each suggestion")
+var heatmap = flag.Bool("heatmap", false, "prints a heatmap of letter frequency by position with each suggestion")
+var minNewLetters = flag.Int("min-new-letters", 0, "prefers guesses with at least `N` letters not in previous guesses")
+var noPlurals = flag.Bool("no-plurals", false, "ranks words that look like plurals below all other suggestions, since answers are rarely plural")
+var diverse = flag.Bool("diverse", false, "suggests words that differ in their letters rather than only the top words")
+var scoreMode = flag.String("score", "exp", "how to rank guesses: exp (expected next-set size, then frequency), composite (see -alpha), coverage (distinct common letters), blended (letter score plus frequency rank, see -beta), info-positions (letters in positions that split the candidates evenly), guesses (expected guesses to finish, estimated from exp), entropy (expected bits of information), or minimax (worst-case next-set size)")
+var beta = flag.Float64("beta", 1, "with -score blended, the weight of frequency rank against letter score")
+var alpha = flag.Float64("alpha", 1, "with -score composite, the weight of log frequency against expected next-set size")
+var weighted = flag.Bool("weighted", false, "weights the expected next-set size by answer frequency")
+var table = flag.Bool("table", false, "suggests by printing a table of metrics for every candidate")
+var sortBy = flag.String("sort", "exp", "the metric by which to sort the -table: freq, score, exp, or entropy")
+var dotPath = flag.String("dot", "", "writes the decision tree from opening with -guess0, or the best guess, as Graphviz DOT to the `file`")
+var dotDepth = flag.Int("dot-depth", 2, "with -dot, the number of guesses deep to draw the tree")
+var dotBreadth = flag.Int("dot-breadth", 8, "with -dot, the number of largest feedback groups to follow from each guess")
+var secondTable = flag.String("second-table", "", "prints the best second guess for each feedback to opening with `word`")
+var trainCurve = flag.Bool("train-guesscurve", false, "simulates play against every candidate and prints the table of expected further guesses for -score guesses")
+var compareN = flag.Int("compare-strategies", 0, "compares each -score mode by simulating play against a -seed random sample of `N` answers")
+var rankOpeners = flag.Int("rank-openers", 0, "ranks the top `N` opening guesses by simulating play against every answer")
+
+var cpuProfile = flag.String("cpuprofile", "", "writes a CPU profile to the `file`")
+var memProfile = flag.String("memprofile", "", "writes a memory profile to the `file` on exit")
 
 func main() {
 	flag.Parse()
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Printf("failed to create CPU profile: %s\n", err)
+			os.Exit(1)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Printf("failed to start CPU profile: %s\n", err)
+			os.Exit(1)
+		}
+		defer pprof.StopCPUProfile()
+	}
+	if *memProfile != "" {
+		defer func() {
+			f, err := os.Create(*memProfile)
+			if err != nil {
+				fmt.Printf("failed to create memory profile: %s\n", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fmt.Printf("failed to write memory profile: %s\n", err)
+			}
+		}()
+	}
+	if _, ok := tableLess[*sortBy]; !ok {
+		fmt.Printf("unknown -sort metric: %s\n", *sortBy)
+		os.Exit(1)
+	}
+	if !contains(scoreModes, *scoreMode) {
+		fmt.Printf("unknown -score: %s\n", *scoreMode)
+		os.Exit(1)
+	}
+	if *resultFormat != "human" && *resultFormat != "json" {
+		fmt.Printf("unknown -result-format: %s\n", *resultFormat)
+		os.Exit(1)
+	}
+	if !contains(freqFormats, *freqFormat) {
+		fmt.Printf("unknown -format: %s\n", *freqFormat)
+		os.Exit(1)
+	}
+	if err := setTileSymbols(*symAbsent, *symPresent, *symCorrect); err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	if *alphabetSpec != "auto" {
+		if err := setAlphabet([]rune(*alphabetSpec)); err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *validate {
+		ok, err := validateFreqFiles(*freqFiles)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	words, err := initialCandidates(*freqFiles)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+
+	if *puzzle >= 0 {
+		if len(puzzleAnswers) == 0 {
+			fmt.Println("-puzzle: no puzzle answer list is bundled; use -answer")
+			os.Exit(1)
+		}
+		if *puzzle >= len(puzzleAnswers) {
+			fmt.Printf("-puzzle: no answer for puzzle %d; the last bundled puzzle is %d\n",
+				*puzzle, len(puzzleAnswers)-1)
+			os.Exit(1)
+		}
+		*answer = puzzleAnswers[*puzzle]
+	}
+
+	// The alphabet may come from the word list,
+	// so words from flags can only be encoded after loading it.
+	for _, f := range []*string{secret, guess0} {
+		if *f == "" {
+			continue
+		}
+		w, ok := encodeWord(*f)
+		if !ok {
+			fmt.Printf("%s is not 5 letters of the alphabet\n", *f)
+			os.Exit(1)
+		}
+		*f = w
+	}
+
+	if *logPath != "" {
+		f, err := os.Create(*logPath)
+		if err != nil {
+			fmt.Printf("failed to create log file: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		gameLog = json.NewEncoder(f)
+	}
+
+	if *best {
+		sortWords(words)
+		fmt.Println(decodeWord(words[len(words)-1].word))
+		return
+	}
+
+	if *absurdle {
+		playAbsurdle(words)
+		return
+	}
+
+	if *secondTable != "" {
+		opener, ok := encodeWord(*secondTable)
+		if !ok {
+			fmt.Printf("%s is not 5 letters of the alphabet\n", *secondTable)
+			os.Exit(1)
+		}
+		printSecondTable(words, opener)
+		return
+	}
+
+	if *dotPath != "" {
+		opener := *guess0
+		if opener == "" {
+			opener = nextGuess(append([]word(nil), words...), 0, "", "")
+		}
+		f, err := os.Create(*dotPath)
+		if err != nil {
+			fmt.Printf("failed to create DOT file: %s\n", err)
+			os.Exit(1)
+		}
+		err = writeDot(f, words, opener)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Printf("failed to write DOT file: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *trainCurve {
+		trainGuessCurve(words)
+		return
+	}
+
+	if *compareN > 0 {
+		compareStrategies(words, *compareN)
+		return
+	}
+
+	if *rankOpeners > 0 {
+		rankOpenersReport(words, *rankOpeners)
+		return
+	}
+
+	if *lookup {
+		if err := lookupWords(words, *known); err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	words := initialCandidates()
+	if *replayPath != "" {
+		if err := replay(words, *replayPath); err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	if *answer != "" {
-		c := newConstraints()
-		n := 0
-		pass := false
-		for len(words) > 0 {
-			var guess string
-			if n == 0 && *guess0 != "" {
-				// The first call to sortWords is very slow,
-				// allow specifying the hard-coded guess
-				// from the command-line to speed up.
-				guess = *guess0
-			} else {
-				sortWords(words)
-				guess = words[len(words)-1].word
+		var answers []string
+		for _, a := range strings.Split(*answer, ",") {
+			w, ok := encodeWord(strings.TrimSpace(a))
+			if !ok {
+				fmt.Printf("%s is not 5 letters of the alphabet\n", a)
+				os.Exit(1)
 			}
-			if *verbose {
-				fmt.Printf("guess: %s\n", guess)
+			answers = append(answers, w)
+		}
+		playAnswers(words, answers)
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	s := &session{words: words, cache: newSuggestCache(*cacheSize)}
+	fmt.Println("Enter the feedback for each guess, or 'help' for a list of commands.")
+	s.suggest()
+	if s.initial == nil {
+		s.initial = append([]word(nil), s.words...)
+	}
+
+	// On interrupt, summarize the game before exiting,
+	// unless input is being handled, which may take a while,
+	// and leaves the session partly updated until it's done;
+	// then exit at once, as without the handler.
+	var mu sync.Mutex
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		fmt.Println()
+		if mu.TryLock() {
+			s.summarize()
+		}
+		os.Exit(1)
+	}()
+
+	for !s.quit {
+		if s.over() {
+			fmt.Println("Enter 'reset' to start a new game, or 'quit' to quit.")
+		}
+		fmt.Printf("> ")
+		if !scanner.Scan() {
+			mu.Lock()
+			if err := scanner.Err(); err != nil {
+				fmt.Printf("\nfailed to read input: %s\n", err)
+			} else {
+				// The input ended without a quit.
+				fmt.Println()
 			}
-			n++
-			if guess == *answer {
-				pass = true
-				break
+			s.summarize()
+			mu.Unlock()
+			break
+		}
+		mu.Lock()
+		s.input(scanner.Text())
+		mu.Unlock()
+	}
+}
+
+// session is the state of an interactive game.
+type session struct {
+	// initial are the sorted initial candidates.
+	initial []word
+	// words are the remaining candidates.
+	words []word
+	// clues are the feedback applied so far, in order.
+	clues []clue
+	// stack are the candidates before each of the clues,
+	// so undo needn't filter again.
+	stack [][]word
+	// undone are the clues undone, most recent last,
+	// with the candidates after each, for redo.
+	// It is cleared when new feedback is applied.
+	undone []undoneClue
+	// confirmed is whether the last candidate was confirmed, with -confirm.
+	confirmed bool
+	// quit is whether the user has asked to quit.
+	quit bool
+	// cache are the sorted candidates of recent states.
+	cache *suggestCache
+}
+
+// clue is feedback applied during a game.
+type clue struct {
+	// line is the feedback as entered.
+	line string
+	c    *constraints
+}
+
+// undoneClue is a clue that was undone,
+// with the candidates that remained after it.
+type undoneClue struct {
+	clue  clue
+	words []word
+}
+
+// copyWords returns a copy of the remaining candidates,
+// to filter without changing those saved on the stack.
+func (s *session) copyWords() []word {
+	return append([]word(nil), s.words...)
+}
+
+// over returns whether the current game is over.
+func (s *session) over() bool {
+	return len(s.words) == 0 || len(s.words) == 1 && (!*confirm || s.confirmed)
+}
+
+// command is an interactive command.
+type command struct {
+	name string
+	// args is a synopsis of the arguments, printed by help.
+	args string
+	// doc is a one-line description, printed by help.
+	doc string
+	run func(s *session, args []string)
+}
+
+// commands are the interactive commands.
+// They are set in init, since the help command refers to commands.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name: "help",
+			doc:  "prints this help",
+			run:  func(*session, []string) { printHelp() },
+		},
+		{
+			name: "quit",
+			doc:  "quits",
+			run:  func(s *session, _ []string) { s.quit = true },
+		},
+		{
+			name: "guess",
+			args: "<word>",
+			doc:  "with -secret, prints and applies the feedback for guessing word",
+			run:  (*session).guess,
+		},
+		{
+			name: "match",
+			args: "<pattern>",
+			doc:  "prints candidates matching pattern, where _ matches any letter",
+			run:  (*session).match,
+		},
+		{
+			name: "answers",
+			args: "[n]",
+			doc:  "prints the n most frequent candidates, default 20",
+			run:  (*session).answers,
+		},
+		{
+			name: "cloud",
+			args: "<file>",
+			doc:  "writes each candidate and its chance of being the answer to file, for a word cloud",
+			run:  (*session).cloud,
+		},
+		{
+			name: "with",
+			args: "<letter>",
+			doc:  "prints candidates containing letter",
+			run:  func(s *session, args []string) { s.withLetter(args, true) },
+		},
+		{
+			name: "without",
+			args: "<letter>",
+			doc:  "prints candidates not containing letter",
+			run:  func(s *session, args []string) { s.withLetter(args, false) },
+		},
+		{
+			name: "compare",
+			args: "<word> <word>",
+			doc:  "prints the expected next-set size, worst case, and entropy of two guesses",
+			run:  (*session).compare,
+		},
+		{
+			name: "simulate",
+			args: "<answer>",
+			doc:  "prints the guesses that would finish the game if the answer were answer",
+			run:  (*session).simulate,
+		},
+		{
+			name: "mode",
+			args: "<name>",
+			doc:  "changes the -score mode and suggests again",
+			run:  (*session).mode,
+		},
+		{
+			name: "history",
+			doc:  "prints the feedback entered so far, in order",
+			run:  (*session).history,
+		},
+		{
+			name: "undo",
+			doc:  "undoes the last feedback",
+			run:  (*session).undo,
+		},
+		{
+			name: "redo",
+			doc:  "reapplies the last undone feedback",
+			run:  (*session).redo,
+		},
+		{
+			name: "reset",
+			doc:  "starts a new game",
+			run:  (*session).reset,
+		},
+		{
+			name: "stats",
+			doc:  "prints the most common letters among the candidates",
+			run:  func(s *session, _ []string) { printStats(s.words) },
+		},
+		{
+			name: "heatmap",
+			doc:  "prints a heatmap of letter frequency by position among the candidates",
+			run:  func(s *session, _ []string) { printHeatmap(s.words) },
+		},
+	}
+}
+
+// input handles a line of user input,
+// which is either a command or the feedback for a guess.
+func (s *session) input(line string) {
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		for _, cmd := range commands {
+			if cmd.name == fields[0] {
+				cmd.run(s, fields[1:])
+				return
 			}
-			clearConstraints(c)
-			applyDiffConstraint(c, guess, *answer)
-			if *verbose {
-				fmt.Printf("%s\n", c)
+		}
+	}
+	sc := inputSoftConstraints(line)
+	if sc == nil {
+		printFeedbackHelp()
+		fmt.Println("'help' for a list of commands.")
+		return
+	}
+	c := newConstraints()
+	applyFeedback(c, sc.guess, sc.f)
+	if *verbose {
+		printConstraints(c)
+	}
+	if *strict {
+		if conflicts := s.conflicts(c); len(conflicts) > 0 {
+			for _, conflict := range conflicts {
+				fmt.Println(conflict)
 			}
-			words = filter(c, words)
+			fmt.Println("Feedback not applied.")
+			return
 		}
-		if pass {
-			fmt.Printf("passed in ")
-		} else {
-			fmt.Printf("failed in ")
+	}
+	if sc.uncertain(*minConfidence) {
+		s.apply(line, c, filterSoft(sc, s.copyWords(), *minConfidence))
+		return
+	}
+	s.apply(line, c, filter(c, s.copyWords()))
+}
+
+// conflicts returns descriptions of how c contradicts
+// the feedback from earlier turns.
+func (s *session) conflicts(c *constraints) []string {
+	var conflicts []string
+	for i, cl := range s.clues {
+		for _, reason := range contradictions(cl.c, c) {
+			conflicts = append(conflicts,
+				fmt.Sprintf("conflicts with turn %d (%s): %s", i+1, cl.line, reason))
 		}
-		fmt.Printf("%d guesses\n", n)
+	}
+	return conflicts
+}
+
+// apply records the feedback line and its constraints, c,
+// and suggests from the remaining candidates, words,
+// which are the current candidates filtered by c.
+// Unless the feedback is all correct, the guess is not the answer,
+// so it is removed from the candidates, even if words has it.
+func (s *session) apply(line string, c *constraints, words []word) {
+	s.clues = append(s.clues, clue{line: line, c: c})
+	s.stack = append(s.stack, s.words)
+	s.undone = nil
+	if sc := inputSoftConstraints(line); sc != nil && sc.f != allCorrect {
+		words = removeWord(words, sc.guess)
+	}
+	n := len(s.words)
+	s.words = words
+	if n == 1 && len(s.words) == 1 {
+		fmt.Printf("Confirmed: %s\n", decodeWord(s.words[0].word))
+		s.confirmed = true
 		return
 	}
+	s.suggest()
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	suggest(words)
-	for len(words) > 1 {
-		fmt.Printf("> ")
-		if !scanner.Scan() || scanner.Text() == "quit" {
-			break
+// lookupWords prints, most frequent first, the words
+// consistent with known, a comma-separated list of
+// feedback lines and patterns of 5 letters or _.
+// The words must be sorted most-frequent first.
+func lookupWords(words []word, known string) error {
+	for _, k := range strings.Split(known, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
 		}
-		c := inputConstraints(scanner.Text())
-		if *verbose {
-			fmt.Printf("%s\n", c)
+		if pattern, ok := parsePattern(k); ok {
+			var i int
+			for _, w := range words {
+				if matchPattern(pattern, w.word) {
+					words[i] = w
+					i++
+				}
+			}
+			words = words[:i]
+			continue
 		}
+		c := inputConstraints(k)
 		if c == nil {
-			fmt.Println("Enter 5 fields of the form XY where X is -, +, or ~ and Y is a letter a-z.")
-			fmt.Println("	- means wrong letter; doesn't appear in the word")
-			fmt.Println("	+ means correct letter")
-			fmt.Println("	~ means letter appears in the word in a different position")
-			fmt.Println("'quit' to quit.")
-			continue
+			return fmt.Errorf("-known: %q is neither feedback nor a pattern", k)
 		}
 		words = filter(c, words)
-		suggest(words)
 	}
+	for _, w := range words {
+		fmt.Printf("%s %d\n", decodeWord(w.word), w.freq)
+	}
+	fmt.Printf("%d matching words\n", len(words))
+	outputCandidates(words)
+	return nil
 }
 
-type word struct {
-	word  string
-	freq  int
-	score int
-	exp   float64
+// match prints the candidates matching the pattern args[0],
+// regardless of the feedback so far.
+// A _ in the pattern matches any letter;
+// other letters match only themselves.
+func (s *session) match(args []string) {
+	var pattern [5]byte
+	ok := false
+	if len(args) == 1 {
+		pattern, ok = parsePattern(args[0])
+	}
+	if !ok {
+		fmt.Println("Enter match followed by 5 letters or _, for example _r_ne.")
+		return
+	}
+	var matches []string
+	for _, w := range s.words {
+		if matchPattern(pattern, w.word) {
+			matches = append(matches, decodeWord(w.word))
+		}
+	}
+	for _, m := range matches {
+		fmt.Println(m)
+	}
+	fmt.Printf("%d matching candidates\n", len(matches))
 }
 
-func initialCandidates() []word {
-	data, err := ioutil.ReadFile(freqListPath)
-	if err != nil {
-		fmt.Printf("failed to read frequency file: %s", err)
-		os.Exit(1)
+// answers prints the args[0] most frequent remaining candidates,
+// most frequent first, or 20 if there are no args.
+func (s *session) answers(args []string) {
+	n := 20
+	if len(args) > 0 {
+		var err error
+		n, err = strconv.Atoi(args[0])
+		if len(args) > 1 || err != nil || n < 1 {
+			fmt.Println("Enter answers optionally followed by a positive number.")
+			return
+		}
 	}
-	words := make([]word, 0, 4096)
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		w := fields[0]
-		if len(w) != 5 || strings.IndexFunc(w, func(r rune) bool {
-			return r < 'a' || r > 'z'
-		}) >= 0 {
-			continue
+	words := append([]word(nil), s.words...)
+	sort.SliceStable(words, func(i, j int) bool { return words[i].freq > words[j].freq })
+	if n > len(words) {
+		n = len(words)
+	}
+	for _, w := range words[:n] {
+		fmt.Printf("%-8s (freq: %d)\n", decodeWord(w.word), w.freq)
+	}
+	fmt.Printf("%d possible answers\n", len(words))
+}
+
+// cloud writes the remaining candidates to the file args[0],
+// most frequent first, one per line, each followed by its weight:
+// its share of the candidates' total frequency.
+func (s *session) cloud(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Enter cloud followed by a file name.")
+		return
+	}
+	words := append([]word(nil), s.words...)
+	sort.SliceStable(words, func(i, j int) bool { return words[i].freq > words[j].freq })
+	total := totalFreq(words)
+	var buf bytes.Buffer
+	for _, w := range words {
+		weight := 0.0
+		if total > 0 {
+			weight = float64(w.freq) / float64(total)
 		}
-		freq, err := strconv.Atoi(fields[1])
-		if err != nil {
-			fmt.Printf("failed to parse word frequency: %s", err)
-			os.Exit(1)
+		fmt.Fprintf(&buf, "%s %g\n", decodeWord(w.word), weight)
+	}
+	if err := ioutil.WriteFile(args[0], buf.Bytes(), 0644); err != nil {
+		fmt.Printf("failed to write word cloud: %s\n", err)
+		return
+	}
+	fmt.Printf("Wrote %d candidates to %s\n", len(words), args[0])
+}
+
+// withLetter prints the candidates that contain the letter args[0],
+// or that don't contain it if with is false,
+// regardless of the feedback so far.
+func (s *session) withLetter(args []string, with bool) {
+	var b byte
+	ok := false
+	if len(args) == 1 {
+		b, ok = encodeLetter(strings.ToLower(args[0]))
+	}
+	if !ok {
+		fmt.Println("Enter a single letter.")
+		return
+	}
+	n := 0
+	for _, w := range s.words {
+		if strings.IndexByte(w.word, b) >= 0 == with {
+			fmt.Println(decodeWord(w.word))
+			n++
 		}
-		words = append(words, word{word: w, freq: freq})
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("error reading frequency file: %s", err)
-		os.Exit(1)
+	fmt.Printf("%d matching candidates\n", n)
+}
+
+// parsePattern returns the pattern for the string of 5 letters or _,
+// with 0 for each _, and whether the string was a valid pattern.
+func parsePattern(str string) ([5]byte, bool) {
+	var pattern [5]byte
+	n := 0
+	for _, r := range strings.ToLower(str) {
+		if n == len(pattern) {
+			return pattern, false
+		}
+		if r != '_' {
+			b, ok := letterCodes[r]
+			if !ok {
+				return pattern, false
+			}
+			pattern[n] = b
+		}
+		n++
 	}
-	return words
+	return pattern, n == len(pattern)
 }
 
-type constraints struct {
-	position    [5]byte
-	notPosition [5][26]bool
-	contains    []byte
+// matchPattern returns whether word matches pattern,
+// where a 0 in the pattern matches any letter.
+func matchPattern(pattern [5]byte, word string) bool {
+	for i, b := range pattern {
+		if b != 0 && word[i] != b {
+			return false
+		}
+	}
+	return true
 }
 
-func newConstraints() *constraints {
-	return &constraints{
-		position:    [5]byte{},
-		notPosition: [5][26]bool{[26]bool{}, [26]bool{}, [26]bool{}, [26]bool{}, [26]bool{}},
-		contains:    nil,
+// compare prints metrics of guessing args[0] and args[1]
+// against the remaining candidates side by side.
+// Neither guess needs to be a candidate.
+func (s *session) compare(args []string) {
+	var guesses [2]string
+	ok := len(args) == 2
+	for i := 0; ok && i < 2; i++ {
+		guesses[i], ok = encodeWord(strings.ToLower(args[i]))
+	}
+	if !ok {
+		fmt.Println("Enter compare followed by two 5-letter words.")
+		return
+	}
+	if len(s.words) == 0 {
+		fmt.Println("No candidates remain.")
+		return
+	}
+	fmt.Printf("%-8s %-8s %-8s\n", "", decodeWord(guesses[0]), decodeWord(guesses[1]))
+	for _, metric := range []string{"exp", "minimax", "entropy"} {
+		fmt.Printf("%-8s", metric)
+		for _, g := range guesses {
+			fmt.Printf(" %-8.2f", scorers[metric].score(s.words, s.words, g))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%-8s", "sets")
+	for _, g := range guesses {
+		fmt.Printf(" %-8d", len(partition(s.words, g)))
 	}
+	fmt.Println()
 }
 
-func (c *constraints) String() string {
-	var s strings.Builder
-	for i := 0; i < 5; i++ {
-		if c.position[i] != 0 {
-			fmt.Fprintf(&s, "+%c ", c.position[i])
+// simulate prints the guesses and feedback that would finish the game
+// from the remaining candidates if the answer were args[0],
+// without changing the session.
+func (s *session) simulate(args []string) {
+	var answer string
+	ok := false
+	if len(args) == 1 {
+		answer, ok = encodeWord(strings.ToLower(args[0]))
+	}
+	if !ok {
+		fmt.Println("Enter simulate followed by a 5-letter word.")
+		return
+	}
+	if !hasWord(s.words, answer) {
+		fmt.Printf("%s is not a candidate.\n", decodeWord(answer))
+		return
+	}
+	words := append([]word(nil), s.words...)
+	guessed := s.guessed()
+	c := newConstraints()
+	for turn := s.turn(); len(words) > 0; turn++ {
+		guess := nextGuess(words, turn-1, "", guessed)
+		guessed += guess
+		f := computeFeedback(guess, answer)
+		fmt.Printf("%d: %s\n", turn, formatFeedback(guess, f))
+		if f == allCorrect {
+			return
 		}
-		for j, not := range c.notPosition[i] {
-			if not {
-				fmt.Fprintf(&s, "-%c ", j+'a')
-			}
+		clearConstraints(c)
+		applyFeedback(c, guess, f)
+		words = removeWord(filter(c, words), guess)
+	}
+}
+
+// removeWord returns words without the encoded word w,
+// removing it in place.
+// A guess that is not the answer may still satisfy its own feedback,
+// for example if every tile is ~ without -yellow-excludes-position,
+// so it must be removed from the candidates explicitly.
+func removeWord(words []word, w string) []word {
+	var i int
+	for _, x := range words {
+		if x.word != w {
+			words[i] = x
+			i++
 		}
-		fmt.Fprintf(&s, "\n")
 	}
-	for _, c := range c.contains {
-		fmt.Fprintf(&s, "%c ", c)
+	return words[:i]
+}
+
+// hasWord returns whether words has the encoded word w.
+func hasWord(words []word, w string) bool {
+	for i := range words {
+		if words[i].word == w {
+			return true
+		}
+	}
+	return false
+}
+
+// mode changes the -score mode to args[0]
+// and suggests again from the remaining candidates.
+func (s *session) mode(args []string) {
+	if len(args) != 1 || !contains(scoreModes, args[0]) {
+		fmt.Printf("Enter mode followed by one of: %s.\n", strings.Join(scoreModes, ", "))
+		return
+	}
+	*scoreMode = args[0]
+	s.suggest()
+}
+
+// history prints the feedback lines applied so far, in order.
+func (s *session) history([]string) {
+	if len(s.clues) == 0 {
+		fmt.Println("No feedback yet.")
+		return
+	}
+	for i, cl := range s.clues {
+		fmt.Printf("%d: %s\n", i+1, cl.line)
+	}
+}
+
+// undo restores the candidates from before the last feedback.
+func (s *session) undo([]string) {
+	if len(s.clues) == 0 {
+		fmt.Println("Nothing to undo.")
+		return
+	}
+	last := len(s.clues) - 1
+	s.undone = append(s.undone, undoneClue{clue: s.clues[last], words: s.words})
+	s.words = s.stack[last]
+	s.clues = s.clues[:last]
+	s.stack = s.stack[:last]
+	s.confirmed = false
+	fmt.Printf("Undid %s\n", s.undone[len(s.undone)-1].clue.line)
+	s.suggest()
+}
+
+// redo reapplies the most recently undone feedback.
+func (s *session) redo([]string) {
+	if len(s.undone) == 0 {
+		fmt.Println("Nothing to redo.")
+		return
+	}
+	last := len(s.undone) - 1
+	u := s.undone[last]
+	s.undone = s.undone[:last]
+	s.clues = append(s.clues, u.clue)
+	s.stack = append(s.stack, s.words)
+	s.words = u.words
+	fmt.Printf("Redid %s\n", u.clue.line)
+	s.suggest()
+}
+
+// reset restores the initial candidates to start a new game.
+func (s *session) reset([]string) {
+	s.words = append([]word(nil), s.initial...)
+	s.clues = nil
+	s.stack = nil
+	s.undone = nil
+	s.confirmed = false
+	if *table {
+		suggest(s.words, "", *startTurn)
+	} else {
+		suggestSorted(s.words, "", *startTurn)
+	}
+	outputCandidates(s.words)
+	s.printTurn()
+}
+
+// outputCandidates writes the words and their frequencies
+// to the -output-candidates file, if any, replacing its contents.
+// The file is in the space-separated frequency file format.
+func outputCandidates(words []word) {
+	if *outputPath == "" {
+		return
+	}
+	var buf bytes.Buffer
+	for _, w := range words {
+		fmt.Fprintf(&buf, "%s %d\n", decodeWord(w.word), w.freq)
+	}
+	// Write to a temporary file and rename it,
+	// so a process watching the file never sees it partly written.
+	tmp := *outputPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write candidates: %s\n", err)
+		return
+	}
+	if err := os.Rename(tmp, *outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write candidates: %s\n", err)
+	}
+}
+
+// suggest suggests words from the remaining candidates,
+// and prints the answer if there is only one.
+func (s *session) suggest() {
+	if *table {
+		suggest(s.words, s.guessed(), s.turn())
+	} else {
+		key := s.stateKey()
+		if sorted, ok := s.cache.get(key); ok {
+			s.words = append([]word(nil), sorted...)
+		} else {
+			sortWords(s.words)
+			s.cache.add(key, append([]word(nil), s.words...))
+		}
+		if s.initial == nil {
+			// Save the sorted initial candidates, before suggestSorted
+			// reorders them, so reset needn't repeat the slow first sort.
+			s.initial = append([]word(nil), s.words...)
+		}
+		suggestSorted(s.words, s.guessed(), s.turn())
+	}
+	outputCandidates(s.words)
+	if *disambiguate && len(s.words) > 2 && s.initial != nil {
+		if g, worst := disambiguator(s.words, s.initial); g != "" {
+			fmt.Printf("Disambiguate: %s leaves at most %d of %d candidates\n",
+				decodeWord(g), worst, len(s.words))
+		}
+	}
+	if len(s.words) == 1 {
+		fmt.Printf("Answer: %s\n", decodeWord(s.words[0].word))
+	}
+	s.printTurn()
+}
+
+// stateKey returns a canonical key for the constraints applied so far
+// and the -score mode, which together determine the sorted candidates.
+func (s *session) stateKey() string {
+	keys := []string{*scoreMode}
+	for _, cl := range s.clues {
+		k := cl.c.compact()
+		if sc := inputSoftConstraints(cl.line); sc != nil && sc.uncertain(*minConfidence) {
+			// Uncertain tiles flag candidates instead of filtering them.
+			k += " " + cl.line
+		}
+		keys = append(keys, k)
+	}
+	// The order of the feedback doesn't change the candidates.
+	sort.Strings(keys[1:])
+	return strings.Join(keys, ";")
+}
+
+// suggestCache is a least-recently-used cache
+// of sorted candidates by session stateKey.
+// A nil *suggestCache caches nothing.
+type suggestCache struct {
+	size    int
+	order   *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	words []word
+}
+
+// newSuggestCache returns a cache of the size most recently used entries,
+// or nil if size is not positive.
+func newSuggestCache(size int) *suggestCache {
+	if size <= 0 {
+		return nil
+	}
+	return &suggestCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the sorted candidates for key, and whether they were cached.
+func (sc *suggestCache) get(key string) ([]word, bool) {
+	if sc == nil {
+		return nil, false
+	}
+	e, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	sc.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).words, true
+}
+
+// add caches the sorted candidates, words, for key,
+// evicting the least recently used entry if the cache is full.
+func (sc *suggestCache) add(key string, words []word) {
+	if sc == nil {
+		return
+	}
+	if e, ok := sc.entries[key]; ok {
+		e.Value.(*cacheEntry).words = words
+		sc.order.MoveToFront(e)
+		return
+	}
+	sc.entries[key] = sc.order.PushFront(&cacheEntry{key: key, words: words})
+	if sc.order.Len() > sc.size {
+		last := sc.order.Back()
+		sc.order.Remove(last)
+		delete(sc.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+// summarize prints the turns used, the number of remaining candidates,
+// and the most preferred guess among them.
+func (s *session) summarize() {
+	fmt.Printf("Used %d turns; %d candidates remain.\n", len(s.clues), len(s.words))
+	// The candidates are sorted by suggest after each turn,
+	// except with -table, which sorts a table of them instead.
+	if len(s.words) > 0 && !*table {
+		fmt.Printf("Best guess: %s\n", decodeWord(s.words[len(s.words)-1].word))
+	}
+}
+
+// guessed returns the letters of the guesses so far.
+func (s *session) guessed() string {
+	var guessed string
+	for _, cl := range s.clues {
+		if sc := inputSoftConstraints(cl.line); sc != nil {
+			guessed += sc.guess
+		}
+	}
+	return guessed
+}
+
+// turn returns the number of the next guess.
+func (s *session) turn() int {
+	return *startTurn + len(s.clues)
+}
+
+// printTurn prints the number of the next guess,
+// with a warning if it is past the last turn.
+func (s *session) printTurn() {
+	turn := s.turn()
+	if *maxGuesses <= 0 {
+		fmt.Printf("Turn %d\n", turn)
+		return
+	}
+	fmt.Printf("Turn %d/%d\n", turn, *maxGuesses)
+	if turn > *maxGuesses {
+		fmt.Printf("Warning: past the %d guesses allowed.\n", *maxGuesses)
+	}
+}
+
+// guess prints and applies the feedback for guessing args[0]
+// when the answer is the -secret word.
+func (s *session) guess(args []string) {
+	if *secret == "" {
+		fmt.Println("guess requires the -secret flag.")
+		return
+	}
+	var g string
+	var ok bool
+	if len(args) == 1 {
+		g, ok = encodeWord(strings.ToLower(args[0]))
+	}
+	if !ok {
+		fmt.Println("Enter guess followed by a 5-letter word.")
+		return
+	}
+	line := formatFeedback(g, computeFeedback(g, *secret))
+	fmt.Println(line)
+	c := newConstraints()
+	applyDiffConstraint(c, g, *secret)
+	if *verbose {
+		printConstraints(c)
+	}
+	s.apply(line, c, filter(c, s.copyWords()))
+}
+
+// printHelp prints the feedback format and the interactive commands.
+func printHelp() {
+	printFeedbackHelp()
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("	%-20s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.doc)
+	}
+}
+
+// printFeedbackHelp prints the format of the feedback for a guess.
+func printFeedbackHelp() {
+	fmt.Printf("Enter 5 fields of the form XY where X is %c, %c, or %c and Y is a letter %c-%c.\n",
+		tileSymbols[absent], tileSymbols[correct], tileSymbols[present],
+		alphabet[0], alphabet[len(alphabet)-1])
+	fmt.Printf("	%c means wrong letter; doesn't appear in the word\n", tileSymbols[absent])
+	fmt.Printf("	%c means correct letter\n", tileSymbols[correct])
+	fmt.Printf("	%c means letter appears in the word in a different position\n", tileSymbols[present])
+	fmt.Println("Each field may end with :C, the confidence in its color from 0 to 1.")
+	fmt.Printf("Or enter the guess followed by its 5 symbols, like crane %c%c%c%c%c.\n",
+		tileSymbols[absent], tileSymbols[present], tileSymbols[correct], tileSymbols[absent], tileSymbols[absent])
+}
+
+// scoreModes are the valid values of the -score flag.
+var scoreModes = []string{"exp", "composite", "coverage", "blended", "info-positions", "guesses", "entropy", "minimax"}
+
+// contains returns whether strs contains s.
+func contains(strs []string, s string) bool {
+	for _, t := range strs {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nextGuess returns the guess to make from the candidates, words,
+// given that n guesses have already been made.
+// If first is non-empty, it is the first guess.
+func nextGuess(words []word, n int, first string, guessed string) string {
+	if n == 0 && first != "" {
+		// The first call to sortWords is very slow,
+		// allow specifying the hard-coded guess
+		// from the command-line to speed up.
+		return first
+	}
+	sortWords(words)
+	preferNewLetters(words, guessed)
+	preferFinish(words, n+1)
+	demoteDisallowed(words)
+	if n == 0 {
+		randomizeOpener(words)
+	}
+	return words[len(words)-1].word
+}
+
+// bestGuess returns the guess to make first from the candidates, words,
+// with the -score scorer and the -fullset and -topn thresholds.
+// It is an error if there are no candidates.
+// The contents of words are reordered.
+func bestGuess(words []word) (string, error) {
+	if len(words) == 0 {
+		return "", fmt.Errorf("no candidate words")
+	}
+	return nextGuess(words, 0, "", ""), nil
+}
+
+// play simulates play to find answer among the candidates, words,
+// returning the number of guesses made and whether answer was found.
+// Play stops without finding answer after -max-guesses guesses.
+// If first is non-empty, it is the first guess.
+// The contents of words are modified.
+func play(words []word, first string, answer string) (int, bool) {
+	sizes, pass := playSizes(words, first, answer)
+	return len(sizes), pass
+}
+
+// playSizes is like play, but returns the number of candidates
+// before each guess, instead of the number of guesses.
+func playSizes(words []word, first string, answer string) ([]int, bool) {
+	c := newConstraints()
+	var sizes []int
+	var guessed string
+	for len(words) > 0 && (*maxGuesses <= 0 || len(sizes) < *maxGuesses) {
+		guess := nextGuess(words, len(sizes), first, guessed)
+		guessed += guess
+		if *verbose {
+			fmt.Printf("guess: %s\n", decodeWord(guess))
+		}
+		sizes = append(sizes, len(words))
+		n := len(sizes)
+		before := len(words)
+		if guess == answer {
+			logGuess(answer, n, guess, allCorrect, before, 1)
+			return sizes, true
+		}
+		clearConstraints(c)
+		applyDiffConstraint(c, guess, answer)
+		if *selfcheck && !satisfies(c, answer) {
+			reportViolation(guess, answer, c)
+		}
+		if *verbose {
+			fmt.Printf("feedback: %s\n", formatFeedback(guess, computeFeedback(guess, answer)))
+			printConstraints(c)
+		}
+		words = removeWord(filter(c, words), guess)
+		logGuess(answer, n, guess, computeFeedback(guess, answer), before, len(words))
+	}
+	return sizes, false
+}
+
+// violationOnce ensures that only the first -selfcheck violation
+// is reported, even when games are simulated in parallel.
+var violationOnce sync.Once
+
+// reportViolation reports, to standard error, the first time that
+// the answer didn't satisfy the constraints c from guessing guess.
+func reportViolation(guess, answer string, c *constraints) {
+	violationOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "selfcheck: guess %s, answer %s: answer does not satisfy %s\n",
+			decodeWord(guess), decodeWord(answer), c.compact())
+	})
+}
+
+// replay applies each line of feedback in the file at path,
+// printing the number of remaining candidates
+// and the most preferred guess after each.
+// Blank lines are skipped.
+func replay(words []word, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read replay file: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		c := inputConstraints(scanner.Text())
+		if c == nil {
+			return fmt.Errorf("%s:%d: bad feedback: %s", path, line, scanner.Text())
+		}
+		words = filter(c, words)
+		fmt.Printf("%s: %d candidates", scanner.Text(), len(words))
+		if len(words) > 0 {
+			sortWords(words)
+			fmt.Printf(", best guess %s", decodeWord(words[len(words)-1].word))
+		}
+		fmt.Println()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading replay file: %w", err)
+	}
+	return nil
+}
+
+// playAnswers simulates play to find each of the answers,
+// starting each game from the initial candidates, words,
+// and prints the result of each game.
+// With more than one answer, it also prints a summary.
+// Answers that are not candidates can't be found,
+// so they are reported, but not played or summarized.
+func playAnswers(words []word, answers []string) {
+	candidates := make(map[string]bool, len(words))
+	for _, w := range words {
+		candidates[w.word] = true
+	}
+	ws := make([]word, len(words))
+	var played, solved, total int
+	for _, a := range answers {
+		if len(answers) > 1 && *resultFormat == "human" {
+			fmt.Printf("%s: ", decodeWord(a))
+		}
+		if !candidates[a] {
+			printNotInList(a)
+			continue
+		}
+		copy(ws, words)
+		sizes, pass := playSizes(ws, *guess0, a)
+		n := len(sizes)
+		if !*trajectory {
+			sizes = nil
+		}
+		printResult(a, pass, n, sizes)
+		played++
+		if pass {
+			solved++
+		}
+		total += n
+	}
+	if len(answers) > 1 && played > 0 {
+		printSummary(played, solved, float64(total)/float64(played))
+	}
+}
+
+// guessRecord is a record of a simulated guess written to the -log file.
+type guessRecord struct {
+	Answer           string `json:"answer"`
+	Turn             int    `json:"turn"`
+	Guess            string `json:"guess"`
+	Feedback         string `json:"feedback"`
+	CandidatesBefore int    `json:"candidatesBefore"`
+	CandidatesAfter  int    `json:"candidatesAfter"`
+}
+
+// gameLog, if non-nil, is where logGuess writes guessRecords.
+var gameLog *json.Encoder
+
+// gameLogMu serializes writes to gameLog,
+// since games may be simulated in parallel.
+var gameLogMu sync.Mutex
+
+// logGuess writes a guessRecord to the gameLog, if there is one.
+func logGuess(answer string, turn int, guess string, fb feedback, before, after int) {
+	if gameLog == nil {
+		return
+	}
+	gameLogMu.Lock()
+	defer gameLogMu.Unlock()
+	err := gameLog.Encode(guessRecord{
+		Answer:           decodeWord(answer),
+		Turn:             turn,
+		Guess:            decodeWord(guess),
+		Feedback:         formatFeedback(guess, fb),
+		CandidatesBefore: before,
+		CandidatesAfter:  after,
+	})
+	if err != nil {
+		fmt.Printf("failed to write log: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// openerRank is the result of simulating play
+// against every answer with a fixed opening guess.
+type openerRank struct {
+	opener string
+	mean   float64
+	worst  int
+	// failures is the number of answers not found.
+	failures int
+}
+
+// rankOpenersReport prints the n most preferred opening guesses
+// ranked by the mean number of guesses to find each of the words.
+func rankOpenersReport(words []word, n int) {
+	sortWords(words)
+	if n > len(words) {
+		n = len(words)
+	}
+	ranks := make([]openerRank, n)
+	for i := range ranks {
+		opener := words[len(words)-1-i].word
+		ranks[i] = rankOpener(words, words, opener)
+		fmt.Fprintf(os.Stderr, "%s (%d/%d)\n", decodeWord(opener), i+1, n)
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		if ranks[i].mean == ranks[j].mean {
+			return ranks[i].worst < ranks[j].worst
+		}
+		return ranks[i].mean < ranks[j].mean
+	})
+	for _, r := range ranks {
+		fmt.Printf("%-8s (mean: %-8.4f worst: %-3d)\n", decodeWord(r.opener), r.mean, r.worst)
+	}
+}
+
+// rankOpener simulates play from the candidates, words,
+// with opener as the first guess
+// against each of answers as the answer, in parallel.
+func rankOpener(words []word, answers []word, opener string) openerRank {
+	answerc := make(chan string)
+	results := make(chan gameOutcome)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws := make([]word, len(words))
+			for answer := range answerc {
+				copy(ws, words)
+				n, pass := play(ws, opener, answer)
+				results <- gameOutcome{n: n, pass: pass}
+			}
+		}()
+	}
+	go func() {
+		for _, w := range answers {
+			answerc <- w.word
+		}
+		close(answerc)
+		wg.Wait()
+		close(results)
+	}()
+	r := openerRank{opener: opener}
+	var total int
+	for o := range results {
+		total += o.n
+		if o.n > r.worst {
+			r.worst = o.n
+		}
+		if !o.pass {
+			r.failures++
+		}
+	}
+	r.mean = float64(total) / float64(len(answers))
+	return r
+}
+
+// gameOutcome is the number of guesses of a simulated game
+// and whether it found the answer.
+type gameOutcome struct {
+	n    int
+	pass bool
+}
+
+// compareStrategies prints the mean and worst number of guesses
+// and the number of failures to find each of a -seed random sample
+// of n of the candidates, words, for each -score mode.
+func compareStrategies(words []word, n int) {
+	answers := words
+	if n < len(words) {
+		answers = sampleWords(words, n)
+	}
+	mode := *scoreMode
+	defer func() { *scoreMode = mode }()
+	for _, m := range scoreModes {
+		*scoreMode = m
+		opener := *guess0
+		if opener == "" {
+			// Sort the first guess once, instead of for every game.
+			opener = nextGuess(append([]word(nil), words...), 0, "", "")
+		}
+		r := rankOpener(words, answers, opener)
+		fmt.Printf("%-15s (opener: %s mean: %-8.4f worst: %-3d failures: %d)\n",
+			m, decodeWord(r.opener), r.mean, r.worst, r.failures)
+	}
+}
+
+// gameResult is the result of a simulated game printed with -result-format json.
+type gameResult struct {
+	Answer  string `json:"answer"`
+	Solved  bool   `json:"solved"`
+	Guesses int    `json:"guesses"`
+	// Exceeded is whether the game failed by using all -max-guesses,
+	// rather than by running out of candidates.
+	Exceeded bool `json:"exceeded"`
+	// Candidates are the number of candidates before each guess,
+	// with -trajectory.
+	Candidates []int `json:"candidates,omitempty"`
+	// Error is why the game was not played, if it wasn't.
+	Error string `json:"error,omitempty"`
+}
+
+// notInList is the error for an answer that is not a candidate.
+const notInList = "answer not in word list"
+
+// printNotInList prints, in the -result-format,
+// that the game to find answer was not played,
+// because answer is not a candidate.
+func printNotInList(answer string) {
+	if *resultFormat == "json" {
+		data, err := json.Marshal(gameResult{Answer: decodeWord(answer), Error: notInList})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	fmt.Println(notInList)
+}
+
+// printResult prints the result of a simulated game
+// to find answer in the -result-format.
+// If sizes is non-nil, it is the number of candidates before each guess,
+// and is printed too.
+func printResult(answer string, pass bool, n int, sizes []int) {
+	exceeded := !pass && *maxGuesses > 0 && n >= *maxGuesses
+	if *resultFormat == "json" {
+		data, err := json.Marshal(gameResult{
+			Answer:     decodeWord(answer),
+			Solved:     pass,
+			Guesses:    n,
+			Exceeded:   exceeded,
+			Candidates: sizes,
+		})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	switch {
+	case pass:
+		fmt.Printf("passed in ")
+	case exceeded:
+		fmt.Printf("failed (exceeded %d) in ", *maxGuesses)
+	default:
+		fmt.Printf("failed in ")
+	}
+	fmt.Printf("%d guesses", n)
+	if sizes != nil {
+		strs := make([]string, len(sizes))
+		for i, size := range sizes {
+			strs[i] = strconv.Itoa(size)
+		}
+		fmt.Printf(" (%s)", strings.Join(strs, " → "))
+	}
+	fmt.Println()
+}
+
+// gameSummary is the summary of several simulated games
+// printed with -result-format json.
+type gameSummary struct {
+	Games   int     `json:"games"`
+	Solved  int     `json:"solved"`
+	Average float64 `json:"average_guesses"`
+}
+
+// printSummary prints the summary of n simulated games
+// in the -result-format.
+func printSummary(n, solved int, avg float64) {
+	if *resultFormat == "json" {
+		data, err := json.Marshal(gameSummary{Games: n, Solved: solved, Average: avg})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	fmt.Printf("solved %d of %d, averaging %.2f guesses\n", solved, n, avg)
+}
+
+// playAbsurdle simulates play against an adversarial host.
+// Instead of having a fixed answer, the host responds to each guess
+// with the feedback that leaves the most candidates.
+func playAbsurdle(words []word) {
+	n := 0
+	pass := false
+	var guess, guessed string
+	for len(words) > 0 {
+		guess = nextGuess(words, n, *guess0, guessed)
+		guessed += guess
+		n++
+		parts := partition(words, guess)
+		var fb feedback
+		max := -1
+		for f, ws := range parts {
+			// Break ties by the smaller feedback value,
+			// so that play is deterministic.
+			if len(ws) > max || len(ws) == max && f < fb {
+				fb = f
+				max = len(ws)
+			}
+		}
+		if *verbose {
+			fmt.Printf("guess: %s\n", decodeWord(guess))
+			fmt.Printf("%s\n", formatFeedback(guess, fb))
+		}
+		if fb == allCorrect {
+			pass = true
+			break
+		}
+		words = removeWord(parts[fb], guess)
+	}
+	// The answer is only known if it was guessed.
+	if !pass {
+		guess = ""
+	}
+	printResult(guess, pass, n, nil)
+}
+
+type word struct {
+	word string
+	// letters are the letters of word, for the hot loops of scoring,
+	// which index them without string bounds checks.
+	letters [5]byte
+	freq    int
+	score   int
+	// exp is the expected next-set size,
+	// or unknownExp if it was not computed.
+	exp float64
+	// coverage is the coverage score, computed with -score coverage.
+	coverage int
+	// value is the score from the -score scorer,
+	// or unknownExp if it was not computed.
+	value float64
+	// plural is whether the word looks like a plural; see isPlural.
+	plural bool
+	// disallowed is whether the word is not in the -allowed list.
+	disallowed bool
+	// flagged is whether the word violates feedback
+	// from a tile with less than -min-confidence.
+	flagged bool
+}
+
+// newWord returns a word for the encoded word w with frequency freq.
+func newWord(w string, freq int) word {
+	ws := word{word: w, freq: freq, plural: isPlural(w)}
+	copy(ws.letters[:], w)
+	return ws
+}
+
+// isPlural returns whether the encoded word looks like a plural:
+// whether it ends in s, but not ss, is, or us.
+// The singular of a 5-letter plural has only 4 letters,
+// so it can't be checked against the candidates.
+func isPlural(w string) bool {
+	s, ok := letterCodes['s']
+	if !ok || w[4] != s {
+		return false
+	}
+	for _, r := range "siu" {
+		if b, ok := letterCodes[r]; ok && w[3] == b {
+			return false
+		}
+	}
+	return true
+}
+
+// isJunk returns whether the word w, not encoded, looks like junk,
+// such as OCR errors, rather than a real answer:
+// whether it has no vowels, counting y, or has a letter 4 or more times.
+func isJunk(w string) bool {
+	if !strings.ContainsAny(w, "aeiouy") {
+		return true
+	}
+	for _, r := range w {
+		if strings.Count(w, string(r)) >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownExp is the exp of a word for which
+// the expected next-set size was not computed.
+const unknownExp = -1
+
+// initialCandidates returns the words from the word-frequency files
+// listed in paths, separated by commas.
+// Each path may be suffixed with :weight,
+// a multiplier for the frequencies in that file.
+// Words listed more than once, whether in one file or several,
+// are a single candidate with the sum of their frequencies.
+// Words with a frequency below -minfreq are dropped.
+// Words that look like junk are counted in a warning,
+// and dropped with -drop-junk.
+// Words not in the -allowed file, if any, are marked disallowed.
+// It is an error if no words are left.
+func initialCandidates(paths string) ([]word, error) {
+	freq := make(map[string]int, 4096)
+	for _, spec := range strings.Split(paths, ",") {
+		path, weight, err := splitFreqSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := readFreqFile(path, weight, freq, nil); err != nil {
+			return nil, err
+		}
+	}
+	if *alphabetSpec == "auto" {
+		if err := setAlphabet(wordLetters(freq)); err != nil {
+			return nil, err
+		}
+	}
+	var allowed map[string]int
+	if *allowedPath != "" {
+		// The allowed list is read like a frequency file,
+		// so it may be a plain word list, with comments.
+		allowed = make(map[string]int)
+		if err := readFreqFile(*allowedPath, 1, allowed, nil); err != nil {
+			return nil, err
+		}
+	}
+	words := make([]word, 0, len(freq))
+	dropped, junk := 0, 0
+	for w, f := range freq {
+		if f < *minFreq {
+			dropped++
+			continue
+		}
+		if isJunk(w) {
+			junk++
+			if *dropJunk {
+				continue
+			}
+		}
+		if ew, ok := encodeWord(w); ok {
+			ws := newWord(ew, f)
+			if allowed != nil {
+				_, ok := allowed[w]
+				ws.disallowed = !ok
+			}
+			words = append(words, ws)
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d words with frequency below %d\n", dropped, *minFreq)
+	}
+	switch {
+	case junk > 0 && *dropJunk:
+		fmt.Fprintf(os.Stderr, "dropped %d words that look like junk\n", junk)
+	case junk > 0:
+		fmt.Fprintf(os.Stderr, "%d words look like junk; see -drop-junk\n", junk)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no candidate words in %s", paths)
+	}
+	// Map iteration order is random;
+	// sort most-frequent first, like the frequency files,
+	// so that results are reproducible.
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].freq == words[j].freq {
+			return words[i].word < words[j].word
+		}
+		return words[i].freq > words[j].freq
+	})
+	return words, nil
+}
+
+// readFreqFile adds the frequencies of the words in the file at path,
+// multiplied by weight, to freq.
+// Lines starting with # and text after a # are comments and are ignored.
+// A file with a single word on every line, or any file with -nofreq-file,
+// is a plain word list, giving each word frequency 1.
+// Malformed lines are skipped with a warning.
+// The lines read are counted in stats, if it is non-nil.
+func readFreqFile(path string, weight float64, freq map[string]int, stats *freqStats) error {
+	if stats == nil {
+		stats = &freqStats{}
+	}
+	seen := make(map[string]bool)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read frequency file: %w", err)
+	}
+	format := *freqFormat
+	// wordsOnly is whether the file has only words, with no frequencies.
+	wordsOnly := *noFreqFile || oneColumn(data, format)
+	detected := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		stats.lines++
+		text, comment := uncomment(scanner.Text())
+		if comment {
+			stats.comments++
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			stats.blank++
+			continue
+		}
+		if format == "auto" {
+			format = detectFormat(text)
+		}
+		fields := splitFields(strings.TrimRight(text, " \t"), format)
+		// first is whether this is the first line with a word.
+		first := !detected
+		detected = true
+		if len(fields) < 2 && !wordsOnly {
+			fmt.Fprintf(os.Stderr, "%s:%d: skipping line with no frequency\n", path, line)
+			stats.noFreq++
+			continue
+		}
+		w := fields[0]
+		// Without frequencies, all words are equally likely.
+		f := 1
+		var err error
+		if !wordsOnly {
+			f, err = strconv.Atoi(fields[1])
+		}
+		if err != nil && first {
+			// Assume that the first line is a header.
+			stats.header++
+			continue
+		}
+		if utf8.RuneCountInString(w) != 5 {
+			stats.wrongLength++
+			continue
+		}
+		if strings.IndexFunc(w, func(r rune) bool { return !inAlphabet(r) }) >= 0 {
+			stats.nonLetters++
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: skipping line with bad frequency: %s\n", path, line, err)
+			stats.badFreq++
+			continue
+		}
+		if seen[w] {
+			stats.duplicates++
+		}
+		seen[w] = true
+		stats.kept++
+		freq[w] += int(float64(f) * weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading frequency file: %w", err)
+	}
+	return nil
+}
+
+// freqStats are counts of the lines read from a frequency file.
+type freqStats struct {
+	lines int
+	// comments is the number of lines with only a # comment.
+	comments int
+	// kept is the number of lines with a 5-letter word and its frequency.
+	kept   int
+	blank  int
+	header int
+	// noFreq is the number of lines with a word but no frequency.
+	noFreq int
+	// wrongLength is the number of lines with a word not of 5 letters.
+	wrongLength int
+	// nonLetters is the number of lines with a word that has
+	// something other than letters of the alphabet.
+	nonLetters int
+	// badFreq is the number of lines with a frequency that is not an integer.
+	badFreq int
+	// duplicates is the number of kept lines with a word
+	// already on an earlier line.
+	duplicates int
+}
+
+// splitFreqSpec returns the path and weight of an element of -freq,
+// a path optionally followed by :weight.
+func splitFreqSpec(spec string) (string, float64, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return spec, 1, nil
+	}
+	w, err := strconv.ParseFloat(spec[i+1:], 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse frequency file weight: %w", err)
+	}
+	return spec[:i], w, nil
+}
+
+// validateFreqFiles prints a report of the lines read
+// from each of the comma-separated frequency files in paths,
+// and returns whether they have no parse errors:
+// lines without a frequency or with a bad frequency.
+func validateFreqFiles(paths string) (bool, error) {
+	ok := true
+	for _, spec := range strings.Split(paths, ",") {
+		path, _, err := splitFreqSpec(spec)
+		if err != nil {
+			return false, err
+		}
+		var stats freqStats
+		if err := readFreqFile(path, 1, make(map[string]int), &stats); err != nil {
+			return false, err
+		}
+		fmt.Printf("%s:\n", path)
+		fmt.Printf("	%d lines\n", stats.lines)
+		fmt.Printf("	%d words kept\n", stats.kept)
+		fmt.Printf("	%d duplicate words\n", stats.duplicates)
+		fmt.Printf("	%d blank lines skipped\n", stats.blank)
+		fmt.Printf("	%d comment lines skipped\n", stats.comments)
+		fmt.Printf("	%d header lines skipped\n", stats.header)
+		fmt.Printf("	%d words not of 5 letters skipped\n", stats.wrongLength)
+		fmt.Printf("	%d words with letters not in the alphabet skipped\n", stats.nonLetters)
+		fmt.Printf("	%d lines with no frequency skipped\n", stats.noFreq)
+		fmt.Printf("	%d lines with a bad frequency skipped\n", stats.badFreq)
+		if stats.noFreq > 0 || stats.badFreq > 0 {
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+// freqFormats are the valid values of the -format flag.
+var freqFormats = []string{"auto", "csv", "tsv", "ssv"}
+
+// uncomment returns the line of a frequency file without any # comment,
+// and whether the line is only a comment.
+func uncomment(line string) (string, bool) {
+	i := strings.IndexByte(line, '#')
+	if i < 0 {
+		return line, false
+	}
+	return line[:i], strings.TrimSpace(line[:i]) == ""
+}
+
+// oneColumn returns whether the frequency file data is a plain word list:
+// whether it has a line with a word, and every such line has a single field.
+func oneColumn(data []byte, format string) bool {
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		text, _ := uncomment(scanner.Text())
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if format == "auto" {
+			format = detectFormat(text)
+		}
+		if len(splitFields(strings.TrimRight(text, " \t"), format)) != 1 {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
+
+// detectFormat returns the format of a frequency file
+// with the given first line.
+func detectFormat(line string) string {
+	switch {
+	case strings.Contains(line, ","):
+		return "csv"
+	case strings.Contains(line, "\t"):
+		return "tsv"
+	default:
+		return "ssv"
+	}
+}
+
+// splitFields returns the fields of a frequency file line in the given format.
+func splitFields(line string, format string) []string {
+	var fields []string
+	switch format {
+	case "csv":
+		fields = strings.Split(line, ",")
+	case "tsv":
+		fields = strings.Split(line, "\t")
+	default:
+		return strings.Fields(line)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// defaultAlphabet is the alphabet used unless the -alphabet flag is set.
+const defaultAlphabet = "abcdefghijklmnopqrstuvwxyz"
+
+// maxLetters is the maximum number of letters in the alphabet.
+const maxLetters = 64
+
+// alphabet is the letters that can appear in words.
+//
+// Internally, words are strings of 5 bytes,
+// each encoding a letter as 'a' plus its index in the alphabet.
+// For the default alphabet, the encoding of a word is the word itself.
+// It is the default alphabet until main sets it from -alphabet.
+var alphabet = []rune(defaultAlphabet)
+
+// letterCodes maps each letter of the alphabet to its encoding.
+var letterCodes = func() map[rune]byte {
+	codes := make(map[rune]byte, len(alphabet))
+	for i, r := range alphabet {
+		codes[r] = byte('a' + i)
+	}
+	return codes
+}()
+
+// setAlphabet sets the alphabet to letters.
+func setAlphabet(letters []rune) error {
+	if len(letters) > maxLetters {
+		return fmt.Errorf("alphabet has %d letters, the maximum is %d", len(letters), maxLetters)
+	}
+	codes := make(map[rune]byte, len(letters))
+	for i, r := range letters {
+		if _, ok := codes[r]; ok {
+			return fmt.Errorf("alphabet has duplicate letter %c", r)
+		}
+		codes[r] = byte('a' + i)
+	}
+	alphabet = letters
+	letterCodes = codes
+	return nil
+}
+
+// inAlphabet returns whether r can be a letter of a word.
+// With -alphabet auto, the alphabet is not yet known
+// while reading the -freq files, so any lower-case letter can.
+func inAlphabet(r rune) bool {
+	if *alphabetSpec == "auto" {
+		return unicode.IsLower(r)
+	}
+	_, ok := letterCodes[r]
+	return ok
+}
+
+// wordLetters returns the sorted letters of the words that are keys of freq.
+func wordLetters(freq map[string]int) []rune {
+	seen := make(map[rune]bool)
+	var letters []rune
+	for w := range freq {
+		for _, r := range w {
+			if !seen[r] {
+				seen[r] = true
+				letters = append(letters, r)
+			}
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return letters
+}
+
+// encodeWord returns the encoding of w,
+// and whether w is 5 letters of the alphabet.
+func encodeWord(w string) (string, bool) {
+	var b [5]byte
+	n := 0
+	for _, r := range w {
+		code, ok := letterCodes[r]
+		if !ok || n == len(b) {
+			return "", false
+		}
+		b[n] = code
+		n++
+	}
+	return string(b[:]), n == len(b)
+}
+
+// encodeLetter returns the encoding of s,
+// and whether s is a single letter of the alphabet.
+func encodeLetter(s string) (byte, bool) {
+	r, n := utf8.DecodeRuneInString(s)
+	code, ok := letterCodes[r]
+	return code, ok && n == len(s)
+}
+
+// decodeWord returns the letters of the encoded word w.
+func decodeWord(w string) string {
+	var s strings.Builder
+	for i := 0; i < len(w); i++ {
+		s.WriteRune(decodeLetter(w[i]))
+	}
+	return s.String()
+}
+
+// decodeLetter returns the letter encoded by b.
+func decodeLetter(b byte) rune {
+	return alphabet[b-'a']
+}
+
+type constraints struct {
+	position    [5]byte
+	notPosition [5][maxLetters]bool
+	// contains are the letters that must be in positions
+	// not already fixed by position.
+	contains []byte
+	// count is, for each letter in contains,
+	// the minimum number of times it must appear in those positions.
+	count [maxLetters]int8
+	// exact is, for each letter in contains,
+	// whether count is also the maximum number of times.
+	exact [maxLetters]bool
+}
+
+func newConstraints() *constraints {
+	return &constraints{
+		position:    [5]byte{},
+		notPosition: [5][maxLetters]bool{},
+		contains:    nil,
+	}
+}
+
+func (c *constraints) String() string {
+	var s strings.Builder
+	for i := 0; i < 5; i++ {
+		if c.position[i] != 0 {
+			fmt.Fprintf(&s, "+%c ", decodeLetter(c.position[i]))
+		}
+		for j, not := range c.notPosition[i] {
+			if not {
+				fmt.Fprintf(&s, "-%c ", alphabet[j])
+			}
+		}
+		fmt.Fprintf(&s, "\n")
+	}
+	for _, b := range c.contains {
+		fmt.Fprintf(&s, "%s ", c.formatContains(b))
+	}
+	return s.String()
+}
+
+// compact returns c on a single line, in a canonical form
+// that is easy to compare across guesses.
+// For example, "pos=_r_n_ no[0]=abc contains=er".
+func (c *constraints) compact() string {
+	var s strings.Builder
+	s.WriteString("pos=")
+	for _, b := range c.position {
+		if b == 0 {
+			s.WriteByte('_')
+		} else {
+			s.WriteRune(decodeLetter(b))
+		}
+	}
+	for i := range c.notPosition {
+		var not []byte
+		for j, n := range c.notPosition[i] {
+			if n {
+				not = append(not, byte(j+'a'))
+			}
+		}
+		if len(not) > 0 {
+			fmt.Fprintf(&s, " no[%d]=%s", i, decodeWord(string(not)))
+		}
+	}
+	if len(c.contains) > 0 {
+		contains := append([]byte{}, c.contains...)
+		sort.Slice(contains, func(i, j int) bool { return contains[i] < contains[j] })
+		s.WriteString(" contains=")
+		for _, b := range contains {
+			s.WriteString(c.formatContains(b))
+		}
+	}
+	return s.String()
+}
+
+// printConstraints prints c for verbose output,
+// in the compact form if -compact is set.
+func printConstraints(c *constraints) {
+	if *compact {
+		fmt.Println(c.compact())
+	} else {
+		fmt.Printf("%s\n", c)
+	}
+}
+
+// contradictions returns descriptions of how constraints a and b
+// contradict each other, such that no word can satisfy both.
+func contradictions(a, b *constraints) []string {
+	var reasons []string
+	for i := 0; i < 5; i++ {
+		x, y := a.position[i], b.position[i]
+		switch {
+		case x != 0 && y != 0 && x != y:
+			reasons = append(reasons, fmt.Sprintf("position %d was %c, now %c", i+1, decodeLetter(x), decodeLetter(y)))
+		case x != 0 && b.notPosition[i][x-'a']:
+			reasons = append(reasons, fmt.Sprintf("position %d was %c, now ruled out", i+1, decodeLetter(x)))
+		case y != 0 && a.notPosition[i][y-'a']:
+			reasons = append(reasons, fmt.Sprintf("%c was ruled out of position %d", decodeLetter(y), i+1))
+		}
+	}
+	for j := range alphabet {
+		x := byte('a' + j)
+		switch {
+		case rulesOut(a, x) && requires(b, x):
+			reasons = append(reasons, fmt.Sprintf("%c was absent, now present", decodeLetter(x)))
+		case requires(a, x) && rulesOut(b, x):
+			reasons = append(reasons, fmt.Sprintf("%c was present, now absent", decodeLetter(x)))
+		}
+	}
+	return reasons
+}
+
+// rulesOut returns whether c rules out b from every position.
+func rulesOut(c *constraints, b byte) bool {
+	for i := 0; i < 5; i++ {
+		if c.position[i] == b || c.position[i] == 0 && !c.notPosition[i][b-'a'] {
+			return false
+		}
+	}
+	return true
+}
+
+// requires returns whether c requires b to be in the word.
+func requires(c *constraints, b byte) bool {
+	for i := 0; i < 5; i++ {
+		if c.position[i] == b {
+			return true
+		}
+	}
+	for _, a := range c.contains {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// formatContains returns the contained letter b,
+// followed by its count in parentheses if more than one is required,
+// or by = and its count if the count is exact.
+func (c *constraints) formatContains(b byte) string {
+	if c.exact[b-'a'] {
+		return fmt.Sprintf("%c(=%d)", decodeLetter(b), c.count[b-'a'])
+	}
+	if n := c.count[b-'a']; n > 1 {
+		return fmt.Sprintf("%c(%d)", decodeLetter(b), n)
+	}
+	return string(decodeLetter(b))
+}
+
+// addContains adds b to the letters that c requires,
+// requiring at least n of them.
+func addContains(c *constraints, b byte, n int8) {
+	if c.count[b-'a'] == 0 {
+		c.contains = append(c.contains, b)
+	}
+	if n > c.count[b-'a'] {
+		c.count[b-'a'] = n
+	}
+}
+
+// inputConstraints returns constraints based on the user input line.
+// The letters are case-insensitive, and must be in the alphabet.
+// Any tile confidences are ignored.
+func inputConstraints(line string) *constraints {
+	sc := inputSoftConstraints(line)
+	if sc == nil {
+		return nil
+	}
+	c := newConstraints()
+	applyFeedback(c, sc.guess, sc.f)
+	return c
+}
+
+// softConstraints are the feedback for a guess
+// along with a confidence in the color of each tile,
+// for feedback read by an imperfect process, like OCR.
+type softConstraints struct {
+	guess      string
+	f          feedback
+	confidence [5]float64
+}
+
+// uncertain returns whether any tile has less than minConfidence.
+func (sc *softConstraints) uncertain(minConfidence float64) bool {
+	for _, conf := range sc.confidence {
+		if conf < minConfidence {
+			return true
+		}
+	}
+	return false
+}
+
+// inputSoftConstraints returns soft constraints based on the user input line.
+// The line has the same format as for inputConstraints,
+// but each field may be followed by :confidence,
+// a number between 0 and 1; the default is 1.
+// The line may instead be the guess followed by its 5 tile symbols,
+// like "crane -~+--", with no confidences.
+func inputSoftConstraints(line string) *softConstraints {
+	// Fields splits on any amount of whitespace,
+	// so stray leading, trailing, or repeated spaces are fine.
+	fields := strings.Fields(line)
+	if len(fields) == 2 {
+		fields = tileFields(fields[0], fields[1])
+	}
+	if len(fields) != 5 {
+		return nil
+	}
+	var guess [5]byte
+	sc := &softConstraints{}
+	for i, field := range fields {
+		// Accept letters copied in upper case.
+		field = strings.ToLower(field)
+		sc.confidence[i] = 1
+		if j := strings.IndexByte(field, ':'); j >= 0 {
+			conf, err := strconv.ParseFloat(field[j+1:], 64)
+			if err != nil || conf < 0 || conf > 1 {
+				return nil
+			}
+			sc.confidence[i] = conf
+			field = field[:j]
+		}
+		op, n := utf8.DecodeRuneInString(field)
+		tile := tileOf(op)
+		b, ok := encodeLetter(field[n:])
+		if tile < 0 || !ok {
+			return nil
+		}
+		guess[i] = b
+		sc.f += feedback(tile) * pow3[i]
+	}
+	sc.guess = string(guess[:])
+	return sc
+}
+
+// tileFields returns the 5 fields, symbol then letter,
+// of the guess and its tile symbols, or nil if either isn't 5 long.
+func tileFields(guess, symbols string) []string {
+	letters, tiles := []rune(guess), []rune(symbols)
+	if len(letters) != 5 || len(tiles) != 5 {
+		return nil
+	}
+	fields := make([]string, 5)
+	for i := range fields {
+		fields[i] = string(tiles[i]) + string(letters[i])
+	}
+	return fields
+}
+
+// filterSoft returns words, filtered to only those words that satisfy
+// the constraints from the tiles of sc with at least minConfidence.
+// Words that violate the constraints of the less confident tiles are kept,
+// but flagged.
+func filterSoft(sc *softConstraints, words []word, minConfidence float64) []word {
+	var use [5]bool
+	for i, conf := range sc.confidence {
+		use[i] = conf >= minConfidence
+	}
+	hard := newConstraints()
+	applyTiles(hard, sc.guess, sc.f, use)
+	all := newConstraints()
+	applyFeedback(all, sc.guess, sc.f)
+	words = filter(hard, words)
+	for i := range words {
+		if !satisfies(all, words[i].word) {
+			words[i].flagged = true
+		}
+	}
+	return words
+}
+
+// filter returns words, filtered to only those words that satisfy the constraints.
+func filter(c *constraints, words []word) []word {
+	var i int
+	for _, w := range words {
+		if satisfiesLetters(c, &w.letters) {
+			words[i] = w
+			i++
+		}
+	}
+	return words[0:i]
+}
+
+// satisfies returns whether a word satisifes the constraints.
+func satisfies(c *constraints, word string) bool {
+	var letters [5]byte
+	copy(letters[:], word)
+	return satisfiesLetters(c, &letters)
+}
+
+// satisfiesLetters is like satisfies, but for the letters of a word.
+func satisfiesLetters(c *constraints, word *[5]byte) bool {
+	for i := 0; i < 5; i++ {
+		got := word[i]
+		if want := c.position[i]; want != 0 {
+			if got != want {
+				return false
+			}
+		} else {
+			if c.notPosition[i][got-'a'] {
+				return false
+			}
+		}
+	}
+	// A ~ tile marks a copy of its letter beyond any marked +,
+	// so only the positions not fixed by + can hold it.
+	// Constraints are built from a single guess, never merged,
+	// so a letter can't move from contains to position.
+	for _, b := range c.contains {
+		var n int8
+		for i := 0; i < 5; i++ {
+			if c.position[i] == 0 && word[i] == b {
+				n++
+			}
+		}
+		if n < c.count[b-'a'] || c.exact[b-'a'] && n > c.count[b-'a'] {
+			return false
+		}
+	}
+	return true
+}
+
+// suggest suggests  words from the candidate set, words,
+// printing the most preferred choice last.
+// The letters of the previous guesses are guessed,
+// and turn is the number of the next guess.
+func suggest(words []word, guessed string, turn int) {
+	if *table {
+		suggestTable(words)
+		return
+	}
+	sortWords(words)
+	suggestSorted(words, guessed, turn)
+}
+
+// suggestSorted is like suggest, but for words already sorted by sortWords.
+func suggestSorted(words []word, guessed string, turn int) {
+	// reason is why the most preferred word is on top, for -explain,
+	// or empty if it is there by the -score ranking.
+	var reason string
+	if *explain && len(words) > 1 && len(words) <= *exactSetSize {
+		if guess, turns := solveExact(words); guess == words[len(words)-1].word {
+			reason = fmt.Sprintf("it finds the answer within %d turns in the worst case", turns)
+		}
+	}
+	reorder := func(why string, f func()) {
+		if len(words) == 0 {
+			return
+		}
+		top := words[len(words)-1].word
+		f()
+		if words[len(words)-1].word != top {
+			reason = why
+		}
+	}
+	reorder("every word scores the same, so it's the most frequent", func() {
+		if equallyGood(words) {
+			// Then the most common word is the most likely answer.
+			sort.SliceStable(words, func(i, j int) bool { return words[i].freq < words[j].freq })
+		}
+	})
+	reorder(fmt.Sprintf("it's the best with at least %d letters not yet guessed", *minNewLetters), func() {
+		preferNewLetters(words, guessed)
+	})
+	reorder("it has the best chance to find the answer in the guesses left", func() {
+		preferFinish(words, turn)
+	})
+	reorder("it's the best word in the -allowed list", func() {
+		demoteDisallowed(words)
+	})
+	if guessed == "" {
+		reorder(fmt.Sprintf("it was chosen at random from the top %d", *randomOpener), func() {
+			randomizeOpener(words)
+		})
+	}
+	printSuggestions(words, reason)
+}
+
+// preferFinish sorts the sorted words by their chance to find the answer
+// within the guesses left, if turn is one of the last two of -max-guesses
+// and there are more candidates than guesses left.
+// Then, minimizing the next set size risks running out of guesses,
+// so the last guess goes for the most likely answer,
+// and the one before it also counts the answers it would leave alone.
+func preferFinish(words []word, turn int) {
+	left := *maxGuesses - turn + 1
+	if *maxGuesses <= 0 || left < 1 || left > 2 || len(words) <= left {
+		return
+	}
+	chance := make(map[string]float64, len(words))
+	for _, w := range words {
+		chance[w.word] = finishChance(words, w.word, left)
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return chance[words[i].word] < chance[words[j].word]
+	})
+}
+
+// finishChance returns the chance, weighting answers by frequency,
+// that guessing guess finds the answer among the candidates, words,
+// within left guesses, of 1 or 2.
+func finishChance(words []word, guess string, left int) float64 {
+	var total, found float64
+	var sizes [allCorrect + 1]int
+	for _, w := range words {
+		total += float64(w.freq)
+		if w.word == guess {
+			found += float64(w.freq)
+		}
+		if left > 1 {
+			sizes[computeFeedback(guess, w.word)]++
+		}
+	}
+	if left > 1 {
+		// An answer alone in its feedback is found by the next guess.
+		for _, w := range words {
+			if w.word != guess && sizes[computeFeedback(guess, w.word)] == 1 {
+				found += float64(w.freq)
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return found / total
+}
+
+// randomizeOpener moves a word chosen uniformly from
+// the -randomize-opener most preferred of the sorted words
+// to the most preferred end, using openerSeed.
+func randomizeOpener(words []word) {
+	k := *randomOpener
+	if k <= 1 || len(words) < 2 {
+		return
+	}
+	if k > len(words) {
+		k = len(words)
+	}
+	rng := rand.New(rand.NewSource(openerSeed()))
+	i := len(words) - 1 - rng.Intn(k)
+	w := words[i]
+	copy(words[i:], words[i+1:])
+	words[len(words)-1] = w
+}
+
+// openerSeed returns -seed if it was set, so the opener can be reproduced,
+// or else the time, so the opener varies from run to run.
+func openerSeed() int64 {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			set = true
+		}
+	})
+	if set {
+		return *seed
+	}
+	return time.Now().UnixNano()
+}
+
+// equalEpsilon is the difference within which
+// the scores of two guesses are considered equal.
+const equalEpsilon = 1e-9
+
+// equallyGood returns whether every word of the sorted words
+// has a score from the -score scorer, all within equalEpsilon.
+func equallyGood(words []word) bool {
+	if len(words) < 2 {
+		return false
+	}
+	for _, w := range words {
+		if w.value == unknownExp || math.Abs(w.value-words[0].value) > equalEpsilon {
+			return false
+		}
+	}
+	return true
+}
+
+// preferNewLetters moves the words with fewer than -min-new-letters
+// distinct letters not in guessed to the least preferred end
+// of the sorted words, keeping their order otherwise.
+func preferNewLetters(words []word, guessed string) {
+	if *minNewLetters <= 0 {
+		return
+	}
+	enough := func(w string) bool {
+		var seen [maxLetters]bool
+		n := 0
+		for i := 0; i < len(w); i++ {
+			if !seen[w[i]-'a'] && strings.IndexByte(guessed, w[i]) < 0 {
+				n++
+			}
+			seen[w[i]-'a'] = true
+		}
+		return n >= *minNewLetters
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return !enough(words[i].word) && enough(words[j].word)
+	})
+}
+
+// printSuggestions prints suggestions from the sorted candidate set, words,
+// printing the most preferred choice last.
+// With -explain, reason is why the most preferred word is on top;
+// see suggestSorted.
+func printSuggestions(words []word, reason string) {
+	n := 20
+	if n >= len(words) {
+		n = len(words)
+	}
+	top := words[len(words)-n : len(words)]
+	if *diverse {
+		top = diverseWords(words, n)
+	}
+	total := totalFreq(words)
+	for _, ws := range top {
+		// bits is the expected information from the feedback, as by -score entropy.
+		counts := feedbackCounts(words, ws.word)
+		bits := entropy(&counts, len(words))
+		fmt.Printf("%-8s (exp: %-8s bits: %-5.2f freq: %-8d score: %-5d",
+			decodeWord(ws.word), formatExp(ws.exp), bits, ws.freq, ws.score)
+		if *probability && total > 0 {
+			fmt.Printf(" p: %5.1f%%", 100*float64(ws.freq)/float64(total))
+		}
+		if *scoreMode == "composite" {
+			q := "-"
+			if ws.exp != unknownExp {
+				q = strconv.FormatFloat(quality(ws), 'f', 2, 64)
+			}
+			fmt.Printf(" quality: %-8s", q)
+		}
+		if *scoreMode == "coverage" {
+			fmt.Printf(" coverage: %-6d", ws.coverage)
+		}
+		if *scoreMode == "blended" {
+			fmt.Printf(" blended: %-8s", formatExp(ws.value))
+		}
+		if *scoreMode == "info-positions" {
+			fmt.Printf(" info: %-6.0f", ws.value)
+		}
+		// With -score guesses, the value is the same estimate.
+		if *showGuesses && *scoreMode != "guesses" {
+			g := "-"
+			if ws.exp != unknownExp {
+				g = strconv.FormatFloat(expectedGuesses(ws.exp), 'f', 2, 64)
+			}
+			fmt.Printf(" guesses: %-5s", g)
+		}
+		if *scoreMode == "guesses" || *scoreMode == "entropy" || *scoreMode == "minimax" {
+			fmt.Printf(" %s: %-8s", *scoreMode, formatExp(ws.value))
+		}
+		if ws.flagged {
+			fmt.Printf(" flagged")
+		}
+		fmt.Printf(")\n")
+	}
+	fmt.Printf("%d candidates\n", len(words))
+	if len(words) > 0 && len(words) <= *confidenceSize && total > 0 {
+		w := words[len(words)-1]
+		fmt.Printf("%.0f%% chance %s is the answer.\n",
+			100*float64(w.freq)/float64(total), strings.ToUpper(decodeWord(w.word)))
+	}
+	if *explain && len(words) > 0 {
+		explainTop(words, reason)
+	}
+	if *heatmap {
+		printHeatmap(words)
+	}
+}
+
+// totalFreq returns the sum of the frequencies of the words.
+func totalFreq(words []word) int {
+	var total int
+	for _, w := range words {
+		total += w.freq
+	}
+	return total
+}
+
+// explainTop prints the rationale for choosing
+// the most preferred word of the sorted candidates, words:
+// reason, if it is non-empty, or else its -score ranking.
+func explainTop(words []word, reason string) {
+	top := words[len(words)-1]
+	var evaluated, rank int
+	for _, w := range words {
+		if w.exp != unknownExp && !(*noPlurals && w.plural) {
+			evaluated++
+		}
+		if w.score > top.score {
+			rank++
+		}
+	}
+	name := strings.ToUpper(decodeWord(top.word))
+	if reason != "" {
+		fmt.Printf("Guessing %s from %d candidates because %s; its letter score ranks %d of %d.\n",
+			name, len(words), reason, rank+1, len(words))
+		return
+	}
+	// With -no-plurals, words that look like plurals are ranked last.
+	among := ""
+	if *noPlurals {
+		among = " that don't look like plurals"
+	}
+	if top.exp == unknownExp {
+		fmt.Printf("Guessing %s from %d candidates, ranked first by %s of the words%s; its letter score ranks %d of %d.\n",
+			name, len(words), *scoreMode, among, rank+1, len(words))
+		return
+	}
+	fmt.Printf("Guessing %s because it reduces %d candidates to an expected %.2f, "+
+		"ranked first of the %d words evaluated%s; its letter score ranks %d of %d.\n",
+		name, len(words), top.exp, evaluated, among, rank+1, len(words))
+}
+
+// diverseWords returns n words chosen greedily from the sorted candidates, words,
+// to span the candidate set rather than differ by a single letter.
+// The first choice is the most preferred word.
+// Each next choice is the word with the most distinct letters
+// not in any word already chosen, breaking ties by preference.
+// Like words, the result is in increasing order of preference:
+// the last word is the first choice.
+func diverseWords(words []word, n int) []word {
+	chosen := make([]word, n)
+	var covered [255]bool
+	used := make([]bool, len(words))
+	for k := n - 1; k >= 0; k-- {
+		// The first choice is the most preferred word,
+		// even if others have more distinct letters.
+		bestIndex := len(words) - 1
+		bestNew := -1
+		for i := len(words) - 1; k < n-1 && i >= 0; i-- {
+			if used[i] {
+				continue
+			}
+			var seen [255]bool
+			var nnew int
+			w := words[i].word
+			for j := 0; j < len(w); j++ {
+				if !covered[w[j]] && !seen[w[j]] {
+					nnew++
+				}
+				seen[w[j]] = true
+			}
+			if nnew > bestNew {
+				bestIndex = i
+				bestNew = nnew
+			}
+		}
+		used[bestIndex] = true
+		chosen[k] = words[bestIndex]
+		w := words[bestIndex].word
+		for j := 0; j < len(w); j++ {
+			covered[w[j]] = true
+		}
+	}
+	return chosen
+}
+
+// tableRow is a row of the table printed by suggestTable.
+type tableRow struct {
+	word
+	entropy float64
+}
+
+// tableLess are the orders of suggestTable rows for each -sort metric,
+// in increasing order of preference.
+var tableLess = map[string]func(a, b tableRow) bool{
+	"freq":    func(a, b tableRow) bool { return a.freq < b.freq },
+	"score":   func(a, b tableRow) bool { return a.score < b.score },
+	"exp":     func(a, b tableRow) bool { return a.exp > b.exp },
+	"entropy": func(a, b tableRow) bool { return a.entropy < b.entropy },
+}
+
+// suggestTable prints every word in the candidate set, words,
+// with its frequency, score, expected next-set size, and entropy,
+// sorted by the -sort metric, printing the most preferred choice last.
+func suggestTable(words []word) {
+	posScore := letterScoreByPosition(letterFreqByPosition(words))
+	rows := make([]tableRow, len(words))
+	for i, w := range words {
+		counts := feedbackCounts(words, w.word)
+		w.score = score(posScore, w.word)
+		w.exp = expectedSize(&counts, len(words))
+		rows[i] = tableRow{word: w, entropy: entropy(&counts, len(words))}
+	}
+	less := tableLess[*sortBy]
+	sort.Slice(rows, func(i, j int) bool {
+		if less(rows[i], rows[j]) == less(rows[j], rows[i]) {
+			return rows[i].freq < rows[j].freq
+		}
+		return less(rows[i], rows[j])
+	})
+	fmt.Printf("%-8s %-10s %-8s %-8s %-8s\n", "word", "freq", "score", "exp", "entropy")
+	for _, r := range rows {
+		fmt.Printf("%-8s %-10d %-8d %-8.2f %-8.4f\n", decodeWord(r.word.word), r.freq, r.score, r.exp, r.entropy)
+	}
+	fmt.Printf("%d candidates\n", len(words))
+}
+
+// formatExp returns exp formatted for printing, or - if it is unknown.
+func formatExp(exp float64) string {
+	if exp == unknownExp {
+		return "-"
+	}
+	return strconv.FormatFloat(exp, 'f', 2, 64)
+}
+
+// sortWords sorts the words in increasing order or preference.
+// The last word is the most preferred.
+// For at most -exact words, the most preferred
+// is the guess that finishes in the fewest turns in the worst case.
+func sortWords(words []word) {
+	rankWords(words)
+	if len(words) > 1 && len(words) <= *exactSetSize {
+		preferExact(words)
+	}
+	demoteDisallowed(words)
+}
+
+// preferExact moves the guess found by solveExact
+// to the most preferred end of the sorted words,
+// keeping the order of the others.
+// If solveExact gives up, the words are unchanged.
+func preferExact(words []word) {
+	guess, _ := solveExact(words)
+	for i := range words {
+		if words[i].word == guess {
+			w := words[i]
+			copy(words[i:], words[i+1:])
+			words[len(words)-1] = w
+			return
+		}
+	}
+}
+
+// exactBudget is the number of guesses that solveExact evaluates
+// before giving up, since the search is exponential in the candidates.
+const exactBudget = 200000
+
+// exactSearch is the state of the search of solveExact.
+type exactSearch struct {
+	// memo are the minimum turns for sets of candidates,
+	// keyed by their sorted words.
+	memo map[string]int
+	// budget is the number of guesses left to evaluate.
+	budget int
+}
+
+// solveExact returns the candidate guess that finds the answer
+// among the candidates, words, in the fewest turns in the worst case,
+// and that number of turns, including the guess itself.
+// Ties go to the guess latest in words.
+// The search is exhaustive, so if it evaluates more than exactBudget guesses,
+// it gives up and returns the empty string.
+func solveExact(words []word) (string, int) {
+	s := &exactSearch{memo: make(map[string]int), budget: exactBudget}
+	var guess string
+	turns := math.MaxInt32
+	for i := len(words) - 1; i >= 0; i-- {
+		if t := s.worstTurns(words, words[i].word); t < turns {
+			guess = words[i].word
+			turns = t
+		}
+	}
+	if s.budget < 0 {
+		return "", 0
+	}
+	return guess, turns
+}
+
+// worstTurns returns the number of turns, including this one,
+// to find the answer among the candidates, words, in the worst case
+// by guessing the candidate guess, then playing optimally.
+// Once the budget is spent, the result is meaningless.
+func (s *exactSearch) worstTurns(words []word, guess string) int {
+	s.budget--
+	if s.budget < 0 {
+		return 1
+	}
+	worst := 1
+	for f, part := range partition(words, guess) {
+		if f == allCorrect {
+			continue
+		}
+		if t := 1 + s.minTurns(part); t > worst {
+			worst = t
+		}
+	}
+	return worst
+}
+
+// minTurns returns the fewest turns to find the answer
+// among the candidates, words, in the worst case.
+// The guess is always a candidate, so each turn removes at least one,
+// and the recursion is no deeper than the number of candidates.
+func (s *exactSearch) minTurns(words []word) int {
+	if len(words) == 1 {
+		return 1
+	}
+	keys := make([]string, len(words))
+	for i := range words {
+		keys[i] = words[i].word
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, "")
+	if t, ok := s.memo[key]; ok {
+		return t
+	}
+	t := math.MaxInt32
+	for i := range words {
+		if w := s.worstTurns(words, words[i].word); w < t {
+			t = w
+		}
+	}
+	s.memo[key] = t
+	return t
+}
+
+// rankWords sorts the words in increasing order or preference
+// by the -score mode.
+func rankWords(words []word) {
+	if *scoreMode == "coverage" {
+		sortByCoverage(words)
+		demotePlurals(words)
+		return
+	}
+	if *scoreMode == "blended" {
+		sortByBlended(words)
+		demotePlurals(words)
+		return
+	}
+	if *scoreMode == "info-positions" {
+		sortByInfo(words)
+		demotePlurals(words)
+		return
+	}
+	posFreq := letterFreqByPosition(words)
+	posScore := letterScoreByPosition(posFreq)
+
+	// Compute word scores as the sum of the letter frequency ranks.
+	// The exp is only computed for the top words below,
+	// so clear any stale value from a previous call.
+	for i := range words {
+		words[i].score = score(posScore, words[i].word)
+		words[i].exp = unknownExp
+		words[i].value = unknownExp
+	}
+	sort.Slice(words, func(i, j int) bool {
+		scorei := words[i].score
+		scorej := words[j].score
+		if scorei == scorej {
+			return words[i].freq < words[j].freq
+		}
+		return scorei < scorej
+	})
+
+	// If the candidate set is not small, only compute next-set size
+	// for the topSetSize words by score.
+	n := len(words)
+	if n > *smallSetSize && *topSetSize < n {
+		n = *topSetSize
+	}
+	top := words[len(words)-n : len(words)]
+	answers := words
+	if *sample > 0 && *sample < len(words) {
+		answers = sampleWords(words, *sample)
+	}
+	sc := scorers[*scoreMode]
+	for i := range top {
+		w := &top[i]
+		switch sc.(type) {
+		case expScorer:
+			w.value = sc.score(words, answers, w.word)
+			w.exp = w.value
+		case guessesScorer:
+			// The guesses are estimated from the exp, so keep it too.
+			w.exp = expScorer{}.score(words, answers, w.word)
+			w.value = expectedGuesses(w.exp)
+		default:
+			w.value = sc.score(words, answers, w.word)
+			if *showGuesses {
+				w.exp = expScorer{}.score(words, answers, w.word)
+			}
+		}
+	}
+	if *scoreMode == "composite" {
+		sort.Slice(top, func(i, j int) bool {
+			qi := quality(top[i])
+			qj := quality(top[j])
+			if qi == qj {
+				return top[i].score < top[j].score
+			}
+			return qi < qj
+		})
+		demotePlurals(top)
+		return
+	}
+	sort.Slice(top, func(i, j int) bool {
+		vi := top[i].value
+		vj := top[j].value
+		if vi == vj {
+			freqi := top[i].freq
+			freqj := top[j].freq
+			if freqi == freqj {
+				return top[i].score < top[j].score
+			}
+			return freqi < freqj
+		}
+		return sc.better(vj, vi)
+	})
+	demotePlurals(top)
+}
+
+// demotePlurals moves the plural words to the least preferred end
+// of the sorted words, keeping their order otherwise, with -no-plurals.
+func demotePlurals(words []word) {
+	if !*noPlurals {
+		return
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return words[i].plural && !words[j].plural
+	})
+}
+
+// demoteDisallowed moves the words not in the -allowed list
+// to the least preferred end of the sorted words,
+// keeping their order otherwise, since the game would reject them.
+func demoteDisallowed(words []word) {
+	if *allowedPath == "" {
+		return
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return words[i].disallowed && !words[j].disallowed
+	})
+}
+
+// scorer scores guesses.
+// sortWords ranks the top words by letter score using the -score scorer.
+type scorer interface {
+	// score returns the score of guessing guess given the candidates, words,
+	// and the possible answers, which are words or a sample of them.
+	score(words []word, answers []word, guess string) float64
+	// better returns whether score a is better than score b.
+	better(a, b float64) bool
+}
+
+// scorers are the scorers for each -score mode that uses one.
+var scorers = map[string]scorer{
+	"exp": expScorer{},
+	// composite ranks words by their quality, computed from the exp.
+	"composite": expScorer{},
+	"guesses":   guessesScorer{},
+	"entropy":   entropyScorer{},
+	"minimax":   minimaxScorer{},
+}
+
+// expScorer scores a guess by its expected next-set size,
+// weighted by answer frequency with -weighted.
+type expScorer struct{}
+
+func (expScorer) score(words []word, answers []word, guess string) float64 {
+	if *weighted {
+		return weightedExpectedNextSetSize(words, answers, guess)
+	}
+	return expectedNextSetSize(words, answers, guess)
+}
+
+func (expScorer) better(a, b float64) bool { return a < b }
+
+// guessesScorer scores a guess by the expected number of guesses
+// to find the answer, including it,
+// estimated from its expected next-set size with guessCurve.
+type guessesScorer struct{}
+
+func (guessesScorer) score(words []word, answers []word, guess string) float64 {
+	return expectedGuesses(expScorer{}.score(words, answers, guess))
+}
+
+// expectedGuesses returns the estimated number of guesses,
+// including this one, to find the answer by guessing a word
+// with expected next-set size exp.
+func expectedGuesses(exp float64) float64 {
+	return 1 + expectedFurtherGuesses(exp)
+}
+
+func (guessesScorer) better(a, b float64) bool { return a < b }
+
+// guessCurve is, for each k, the average number of guesses
+// still needed to find the answer after a guess
+// that left between 2^k and 2^(k+1)-1 candidates.
+// It is increasing, and has at least 2 entries.
+// It was output by -train-guesscurve
+// on freq2_filtered_dedup.txt with the default flags.
+var guessCurve = []float64{
+	1.0000, // 1-1 candidates, 2683 samples
+	1.6106, // 2-3 candidates, 2388 samples
+	2.0181, // 4-7 candidates, 1661 samples
+	2.3348, // 8-15 candidates, 1171 samples
+	2.5711, // 16-31 candidates, 963 samples
+	2.7897, // 32-63 candidates, 756 samples
+	3.0705, // 64-127 candidates, 1049 samples
+}
+
+// expectedFurtherGuesses returns the estimated number of guesses
+// still needed to find the answer after a guess
+// with expected next-set size exp,
+// interpolating the guessCurve between powers of 2,
+// and extrapolating its last slope past its end.
+func expectedFurtherGuesses(exp float64) float64 {
+	x := math.Log2(math.Max(1, exp))
+	k := int(x)
+	if k >= len(guessCurve)-1 {
+		k = len(guessCurve) - 2
+	}
+	return guessCurve[k] + (x-float64(k))*(guessCurve[k+1]-guessCurve[k])
+}
+
+// secondGuess is a row of the -second-table printed with -result-format json.
+type secondGuess struct {
+	Feedback   string `json:"feedback"`
+	Candidates int    `json:"candidates"`
+	Guess      string `json:"guess"`
+}
+
+// printSecondTable prints, for each feedback that guessing opener
+// can give for the candidates, words, the number of candidates left
+// and the best second guess among them, in the -result-format.
+// Feedback that no candidate would give is omitted.
+func printSecondTable(words []word, opener string) {
+	parts := partition(words, opener)
+	fbs := make([]feedback, 0, len(parts))
+	for f := range parts {
+		fbs = append(fbs, f)
+	}
+	sort.Slice(fbs, func(i, j int) bool { return fbs[i] < fbs[j] })
+	for _, f := range fbs {
+		ws := parts[f]
+		sortWords(ws)
+		row := secondGuess{
+			Feedback:   formatFeedback(opener, f),
+			Candidates: len(ws),
+			Guess:      decodeWord(ws[len(ws)-1].word),
+		}
+		if *resultFormat == "json" {
+			data, err := json.Marshal(row)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("%s\n", data)
+			continue
+		}
+		fmt.Printf("%s  %-5d %s\n", row.Feedback, row.Candidates, row.Guess)
+	}
+}
+
+// writeDot writes the decision tree for finding the answer
+// among the candidates, words, opening with opener, as Graphviz DOT.
+// Nodes are labeled by the guess and the number of candidates it's made from,
+// and edges by the feedback leading to the next guess.
+// The tree is drawn -dot-depth guesses deep, and from each guess
+// only the -dot-breadth largest feedback groups are followed.
+func writeDot(w io.Writer, words []word, opener string) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "digraph wordle {\n\tnode [shape=box];\n")
+	var id int
+	var draw func(ws []word, guess string, depth int) int
+	draw = func(ws []word, guess string, depth int) int {
+		n := id
+		id++
+		fmt.Fprintf(b, "\tn%d [label=%q];\n", n, fmt.Sprintf("%s\n%d", decodeWord(guess), len(ws)))
+		if depth >= *dotDepth {
+			return n
+		}
+		parts := partition(ws, guess)
+		delete(parts, allCorrect)
+		fbs := make([]feedback, 0, len(parts))
+		for f := range parts {
+			fbs = append(fbs, f)
+		}
+		sort.Slice(fbs, func(i, j int) bool {
+			if len(parts[fbs[i]]) != len(parts[fbs[j]]) {
+				return len(parts[fbs[i]]) > len(parts[fbs[j]])
+			}
+			return fbs[i] < fbs[j]
+		})
+		for i, f := range fbs {
+			if i == *dotBreadth {
+				fmt.Fprintf(b, "\tn%d [label=%q, shape=plaintext];\n", id, fmt.Sprintf("%d more", len(fbs)-i))
+				fmt.Fprintf(b, "\tn%d -> n%d;\n", n, id)
+				id++
+				break
+			}
+			part := parts[f]
+			sortWords(part)
+			child := draw(part, part[len(part)-1].word, depth+1)
+			fmt.Fprintf(b, "\tn%d -> n%d [label=%q];\n", n, child, formatTiles(f))
+		}
+		return n
+	}
+	draw(words, opener, 1)
+	fmt.Fprintf(b, "}\n")
+	return b.Flush()
+}
+
+// trainGuessCurve simulates play to find each of the candidates, words,
+// and prints the resulting guessCurve as Go source.
+func trainGuessCurve(words []word) {
+	first := *guess0
+	if first == "" {
+		// Sort the first guess once, instead of for every game.
+		first = nextGuess(append([]word(nil), words...), 0, "", "")
+	}
+	var sum []float64
+	var count []int
+	ws := make([]word, len(words))
+	for _, w := range words {
+		copy(ws, words)
+		sizes, pass := playSizes(ws, first, w.word)
+		if !pass {
+			continue
+		}
+		// After guess t, sizes[t] candidates remain,
+		// and len(sizes)-t more guesses find the answer.
+		for t := 1; t < len(sizes); t++ {
+			k := int(math.Log2(float64(sizes[t])))
+			for len(sum) <= k {
+				sum = append(sum, 0)
+				count = append(count, 0)
+			}
+			sum[k] += float64(len(sizes) - t)
+			count[k]++
+		}
+	}
+	fmt.Println("var guessCurve = []float64{")
+	prev := 0.0
+	for k := range sum {
+		// More candidates should never need fewer guesses,
+		// but the largest sets are only seen after the opener,
+		// so their averages depend on it, and can decrease.
+		// Stop where the curve stops increasing;
+		// expectedFurtherGuesses extrapolates from there.
+		if count[k] == 0 || sum[k]/float64(count[k]) <= prev {
+			break
+		}
+		prev = sum[k] / float64(count[k])
+		fmt.Printf("\t%.4f, // %d-%d candidates, %d samples\n", prev, 1<<k, 1<<(k+1)-1, count[k])
 	}
-	return s.String()
+	fmt.Println("}")
 }
 
-// inputConstraints returns constraints based on the user input line.
-func inputConstraints(line string) *constraints {
-	c := newConstraints()
-	fields := strings.Fields(line)
-	if len(fields) != 5 {
-		return nil
-	}
-	for _, field := range fields {
-		if len(field) != 2 {
-			return nil
-		}
-		op := field[0]
-		b := field[1]
-		if op != '-' && op != '+' && op != '~' || b < 'a' || b > 'z' {
-			return nil
+// entropyScorer scores a guess by the expected information
+// given by its feedback, in bits.
+type entropyScorer struct{}
+
+func (entropyScorer) score(_ []word, answers []word, guess string) float64 {
+	counts := feedbackCounts(answers, guess)
+	return entropy(&counts, len(answers))
+}
+
+func (entropyScorer) better(a, b float64) bool { return a > b }
+
+// minimaxScorer scores a guess by the number of answers
+// giving its most common feedback: the worst-case next-set size.
+type minimaxScorer struct{}
+
+func (minimaxScorer) score(_ []word, answers []word, guess string) float64 {
+	counts := feedbackCounts(answers, guess)
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
 		}
 	}
-	// First go through + and ~ ops; we can only understand - after knowing the + positions.
-	for i, field := range fields {
-		switch field[0] {
-		case '+':
-			c.position[i] = field[1]
-		case '~':
-			c.notPosition[i][field[1]-'a'] = true
-			c.contains = append(c.contains, field[1])
+	return float64(max)
+}
+
+func (minimaxScorer) better(a, b float64) bool { return a < b }
+
+// disambiguateScorer scores a guess by its worst-case next-set size,
+// less a fraction for each letter it tests
+// from the positions where the answers differ,
+// so that guesses probing those positions break ties.
+type disambiguateScorer struct{}
+
+func (disambiguateScorer) score(words []word, answers []word, guess string) float64 {
+	varying := varyingLetters(answers)
+	var seen [maxLetters]bool
+	n := 0
+	for i := 0; i < len(guess); i++ {
+		if varying[guess[i]-'a'] && !seen[guess[i]-'a'] {
+			n++
 		}
+		seen[guess[i]-'a'] = true
 	}
-	// Now that we know the + ops, go through and figure out the - ops.
-	for _, field := range fields {
-		if field[0] != '-' {
+	// At most 5 letters, so the bonus never outweighs a whole answer.
+	return minimaxScorer{}.score(words, answers, guess) - float64(n)/6
+}
+
+func (disambiguateScorer) better(a, b float64) bool { return a < b }
+
+// varyingLetters returns the letters of the words
+// in the positions where not all of the words have the same letter.
+func varyingLetters(words []word) [maxLetters]bool {
+	var letters [maxLetters]bool
+	for i := 0; i < 5; i++ {
+		same := true
+		for _, w := range words {
+			if w.word[i] != words[0].word[i] {
+				same = false
+				break
+			}
+		}
+		if same {
 			continue
 		}
-		for i := 0; i < 5; i++ {
-			if c.position[i] == 0 {
-				c.notPosition[i][field[1]-'a'] = true
-			}
+		for _, w := range words {
+			letters[w.word[i]-'a'] = true
 		}
 	}
-	return c
+	return letters
 }
 
-// filter returns words, filtered to only those words that satisfy the constraints.
-func filter(c *constraints, words []word) []word {
-	var i int
+// disambiguator returns the word of pool, not necessarily a candidate,
+// that best separates the candidates, words,
+// by the disambiguateScorer, and its worst-case next-set size.
+// Words not in the -allowed list are skipped.
+// With -prefer-answers, a candidate is preferred to a guess
+// that can't be the answer with the same worst-case next-set size,
+// since it may find the answer.
+func disambiguator(words []word, pool []word) (string, int) {
+	candidates := make(map[string]bool, len(words))
 	for _, w := range words {
-		if satisfies(c, w.word) {
-			words[i] = w
-			i++
+		candidates[w.word] = true
+	}
+	sc := disambiguateScorer{}
+	var best string
+	var bestScore float64
+	for _, w := range pool {
+		if w.disallowed {
+			continue
+		}
+		v := sc.score(words, words, w.word)
+		if *preferAnswers && best != "" && math.Ceil(v) == math.Ceil(bestScore) &&
+			candidates[w.word] != candidates[best] {
+			if candidates[w.word] {
+				best = w.word
+				bestScore = v
+			}
+			continue
+		}
+		if best == "" || sc.better(v, bestScore) {
+			best = w.word
+			bestScore = v
 		}
 	}
-	return words[0:i]
+	return best, int(math.Ceil(bestScore))
 }
 
-// satisfies returns whether a word satisifes the constraints.
-func satisfies(c *constraints, word string) bool {
-	for i := 0; i < 5; i++ {
-		got := word[i]
-		if want := c.position[i]; want != 0 {
-			if got != want {
-				return false
-			}
-		} else {
-			if c.notPosition[i][got-'a'] {
-				return false
+// sortByCoverage sorts the words in increasing order of coverage:
+// the sum, over the distinct letters of the word,
+// of the number of words containing that letter.
+// Repeated letters count once, and position is ignored,
+// so words testing many distinct common letters are preferred.
+func sortByCoverage(words []word) {
+	var letterFreq [255]int
+	for i := range words {
+		var seen [255]bool
+		w := words[i].word
+		for j := 0; j < len(w); j++ {
+			if !seen[w[j]] {
+				seen[w[j]] = true
+				letterFreq[w[j]]++
 			}
 		}
 	}
-	for _, b := range c.contains {
-		found := false
-		for i := 0; i < 5; i++ {
-			if c.position[i] == 0 && word[i] == b {
-				found = true
-				break
+	posScore := letterScoreByPosition(letterFreqByPosition(words))
+	for i := range words {
+		var seen [255]bool
+		w := words[i].word
+		words[i].score = score(posScore, w)
+		words[i].coverage = 0
+		words[i].exp = unknownExp
+		words[i].value = unknownExp
+		for j := 0; j < len(w); j++ {
+			if !seen[w[j]] {
+				seen[w[j]] = true
+				words[i].coverage += letterFreq[w[j]]
 			}
 		}
-		if !found {
-			return false
-		}
 	}
-	return true
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].coverage == words[j].coverage {
+			return words[i].freq < words[j].freq
+		}
+		return words[i].coverage < words[j].coverage
+	})
 }
 
-// suggest suggests  words from the candidate set, words,
-// printing the most preferred choice last.
-func suggest(words []word) {
-	sortWords(words)
-	n := 20
-	if n >= len(words) {
-		n = len(words)
-	}
-	for _, ws := range words[len(words)-n : len(words)] {
-		fmt.Printf("%-8s (exp: %-8.2f freq: %-8d score: %-5d)\n",
-			ws.word, ws.exp, ws.freq, ws.score)
+// sortByBlended sorts the words in increasing order of blended score:
+// the letter score plus -beta times the rank of the word's frequency,
+// with the least frequent word ranked 0.
+// The blended score is the value of each word.
+func sortByBlended(words []word) {
+	posScore := letterScoreByPosition(letterFreqByPosition(words))
+	sort.SliceStable(words, func(i, j int) bool { return words[i].freq < words[j].freq })
+	for i := range words {
+		words[i].score = score(posScore, words[i].word)
+		words[i].exp = unknownExp
+		words[i].value = float64(words[i].score) + *beta*float64(i)
 	}
-	fmt.Printf("%d candidates\n", len(words))
+	sort.SliceStable(words, func(i, j int) bool { return words[i].value < words[j].value })
 }
 
-// sortWords sorts the words in increasing order or preference.
-// The last word is the most preferred.
-func sortWords(words []word) {
+// sortByInfo sorts the words in increasing order of positional information:
+// the sum, over the letters of the word,
+// of the number of candidates that the letter in its position
+// would separate from the rest, whether it is correct there or not.
+// The positional information is the value of each word.
+func sortByInfo(words []word) {
 	posFreq := letterFreqByPosition(words)
 	posScore := letterScoreByPosition(posFreq)
-
-	// Compute word scores as the sum of the letter frequency ranks.
+	posInfo := letterInfoByPosition(posFreq, len(words))
 	for i := range words {
 		words[i].score = score(posScore, words[i].word)
+		words[i].exp = unknownExp
+		words[i].value = float64(score(posInfo, words[i].word))
 	}
 	sort.Slice(words, func(i, j int) bool {
-		scorei := words[i].score
-		scorej := words[j].score
-		if scorei == scorej {
+		if words[i].value == words[j].value {
 			return words[i].freq < words[j].freq
 		}
-		return scorei < scorej
+		return words[i].value < words[j].value
 	})
+}
 
-	// If the candidate set is not small, only compute next-set size
-	// for the topSetSize words by score.
-	n := len(words)
-	if n > smallSetSize && topSetSize < n {
-		n = topSetSize
-	}
-	top := words[len(words)-n : len(words)]
-	for i := range top {
-		top[i].exp = expectedNextSetSize(words, top[i].word)
-	}
-	sort.Slice(top, func(i, j int) bool {
-		expi := top[i].exp
-		expj := top[j].exp
-		if expi == expj {
-			freqi := top[i].freq
-			freqj := top[j].freq
-			if freqi == freqj {
-				return top[i].score < top[j].score
+// letterInfoByPosition returns the number of the n candidates
+// that each letter separates from the others in each position,
+// given the letter frequencies by position of the candidates.
+// That is the number with the letter in the position,
+// or the number without, whichever is fewer.
+// Unlike letterScoreByPosition, a letter in half of the candidates
+// scores higher than a letter in all of them.
+func letterInfoByPosition(posFreq [5][255]int, n int) [5][255]int {
+	var posInfo [5][255]int
+	for i := range posFreq {
+		for b, f := range posFreq[i] {
+			if f < n-f {
+				posInfo[i][b] = f
+			} else {
+				posInfo[i][b] = n - f
 			}
-			return freqi < freqj
 		}
-		return expi > expj
-	})
+	}
+	return posInfo
+}
+
+// quality returns a composite score of w,
+// trading off a small expected next-set size
+// against the likelihood of w being the answer, weighted by -alpha.
+// Higher quality is better.
+func quality(w word) float64 {
+	return -w.exp + *alpha*math.Log(math.Max(1, float64(w.freq)))
 }
 
 // Computes the frequency of each letter in each position.
 func letterFreqByPosition(words []word) [5][255]int {
 	var freq [5][255]int
 	for i := range words {
-		for i, r := range words[i].word {
-			freq[i][r]++
+		w := words[i].word
+		for j := 0; j < len(w); j++ {
+			freq[j][w[j]]++
 		}
 	}
 	return freq
 }
 
+// statsLetters is the number of letters printed for each row of printStats.
+const statsLetters = 8
+
+// printStats prints the most common letters among words,
+// both overall and for each position.
+func printStats(words []word) {
+	posFreq := letterFreqByPosition(words)
+	var total [255]int
+	for i := range posFreq {
+		for r, n := range posFreq[i] {
+			total[r] += n
+		}
+	}
+	fmt.Printf("%-8s", "all")
+	printTopLetters(total)
+	for i := range posFreq {
+		fmt.Printf("%-8d", i+1)
+		printTopLetters(posFreq[i])
+	}
+}
+
+// printTopLetters prints the statsLetters most frequent letters in freq
+// along with their frequencies, most frequent first.
+func printTopLetters(freq [255]int) {
+	var order []byte
+	for i := range alphabet {
+		if b := byte('a' + i); freq[b] > 0 {
+			order = append(order, b)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return freq[order[i]] > freq[order[j]]
+	})
+	if len(order) > statsLetters {
+		order = order[:statsLetters]
+	}
+	for _, b := range order {
+		fmt.Printf("%c:%-6d", decodeLetter(b), freq[b])
+	}
+	fmt.Printf("\n")
+}
+
+// heatmapShades are the characters used by printHeatmap
+// from least to most frequent, when printing to a terminal.
+var heatmapShades = []rune{' ', '░', '▒', '▓', '█'}
+
+// heatmapASCII are the characters used by printHeatmap
+// from least to most frequent, when not printing to a terminal.
+var heatmapASCII = []rune{' ', '.', ':', '*', '#'}
+
+// printHeatmap prints a grid of positions by letters,
+// shaded by the frequency of the letter in the position among words,
+// relative to the most frequent letter in any position.
+func printHeatmap(words []word) {
+	shades := heatmapASCII
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		shades = heatmapShades
+	}
+	posFreq := letterFreqByPosition(words)
+	max := 0
+	for i := range posFreq {
+		for j := range alphabet {
+			if n := posFreq[i]['a'+j]; n > max {
+				max = n
+			}
+		}
+	}
+	fmt.Printf("  %s\n", string(alphabet))
+	for i := range posFreq {
+		fmt.Printf("%d ", i+1)
+		for j := range alphabet {
+			shade := 0
+			if n := posFreq[i]['a'+j]; n > 0 {
+				// Any non-zero frequency gets at least the lightest shade
+				// so that it is distinguishable from no occurrences.
+				shade = 1 + n*(len(shades)-2)/max
+			}
+			fmt.Printf("%c", shades[shade])
+		}
+		fmt.Printf("\n")
+	}
+}
+
 // Computes a letter frequency rank by position.
 // The score is for each position, for each letter in said position,
 // the rank of that letter among all letters sorted in increasing order
@@ -352,30 +3551,94 @@ func letterScoreByPosition(posFreq [5][255]int) [5][255]int {
 // as the sum of the letter frequency ranks by position.
 func score(posScore [5][255]int, word string) int {
 	score := 0
-	for i, r := range word {
-		score += posScore[i][r]
+	for i := 0; i < len(word); i++ {
+		score += posScore[i][word[i]]
 	}
 	return score
 }
 
+// sampleWords returns k words chosen at random from words,
+// reproducibly for the -seed flag.
+func sampleWords(words []word, k int) []word {
+	rng := rand.New(rand.NewSource(*seed))
+	sample := make([]word, k)
+	for i, j := range rng.Perm(len(words))[:k] {
+		sample[i] = words[j]
+	}
+	return sample
+}
+
 // expectedNextSetSize computes the expected next set size;
 // the expecteded number of candidates left after guessing guess
 // given the candidate pool words.
-func expectedNextSetSize(words []word, guess string) float64 {
-	c := newConstraints()
+// The expectation is over the possible answers, answers,
+// which are either words or a sample of them.
+//
+// The candidates left are those giving the same feedback as the answer,
+// so they are counted once per feedback by feedbackCounts,
+// instead of filtering words by the constraints from each answer.
+// With -yellow-excludes-position=false, the constraints are looser
+// than the feedback, so then they are used.
+func expectedNextSetSize(words []word, answers []word, guess string) float64 {
+	if !*yellowExcludes {
+		return filteredNextSetSize(words, answers, guess, false)
+	}
+	counts := feedbackCounts(words, guess)
 	var avg float64
-	for i := range words {
+	for i := range answers {
+		n := counts[computeFeedback(guess, answers[i].word)]
+		avg = avg + (float64(n)-avg)/float64(i+1)
+	}
+	return avg
+}
+
+// weightedExpectedNextSetSize is like expectedNextSetSize,
+// but weights each candidate answer by its frequency,
+// instead of treating all answers as equally likely.
+func weightedExpectedNextSetSize(words []word, answers []word, guess string) float64 {
+	if !*yellowExcludes {
+		return filteredNextSetSize(words, answers, guess, true)
+	}
+	counts := feedbackCounts(words, guess)
+	var sum, total float64
+	for i := range answers {
+		f := float64(answers[i].freq)
+		sum += f * float64(counts[computeFeedback(guess, answers[i].word)])
+		total += f
+	}
+	if total == 0 {
+		return expectedNextSetSize(words, answers, guess)
+	}
+	return sum / total
+}
+
+// filteredNextSetSize is like expectedNextSetSize,
+// or weightedExpectedNextSetSize if weighted is true,
+// but counts the candidates left by filtering words
+// by the constraints from the feedback for each answer.
+func filteredNextSetSize(words []word, answers []word, guess string, weighted bool) float64 {
+	c := newConstraints()
+	var sum, total float64
+	for i := range answers {
 		clearConstraints(c)
-		applyDiffConstraint(c, guess, words[i].word)
+		applyDiffConstraint(c, guess, answers[i].word)
 		var n int
 		for j := range words {
-			if satisfies(c, words[j].word) {
+			if satisfiesLetters(c, &words[j].letters) {
 				n++
 			}
 		}
-		avg = avg + (float64(n)-avg)/float64(i+1)
+		f := 1.0
+		if weighted {
+			f = float64(answers[i].freq)
+		}
+		sum += f * float64(n)
+		total += f
 	}
-	return avg
+	if total == 0 {
+		return filteredNextSetSize(words, answers, guess, false)
+	}
+	return sum / total
 }
 
 func clearConstraints(c *constraints) {
@@ -387,40 +3650,308 @@ func clearConstraints(c *constraints) {
 			c.notPosition[i][j] = false
 		}
 	}
+	for _, b := range c.contains {
+		c.count[b-'a'] = 0
+		c.exact[b-'a'] = false
+	}
 	c.contains = c.contains[:0]
 }
 
 // applyDiffConstraint adds constraints to c assuming we guessed guess
 // but the answer was actually answer.
 func applyDiffConstraint(c *constraints, guess string, answer string) {
+	applyFeedback(c, guess, computeFeedback(guess, answer))
+}
+
+// applyFeedback adds constraints to c assuming we guessed guess
+// and got the feedback f.
+func applyFeedback(c *constraints, guess string, f feedback) {
+	applyTiles(c, guess, f, [5]bool{true, true, true, true, true})
+}
+
+// applyTiles is like applyFeedback,
+// but only adds constraints from the tiles i for which use[i] is true;
+// the colors of the other tiles are unknown.
+func applyTiles(c *constraints, guess string, f feedback, use [5]bool) {
 	// First set the + constraints, because - and ~ depend on knowing the + values.
 	for i := 0; i < 5; i++ {
-		if guess[i] == answer[i] {
+		if use[i] && f.tile(i) == correct {
 			c.position[i] = guess[i]
 		}
 	}
+	// presents counts the letters marked present so far;
+	// each marks another copy of the letter in the answer.
+	var presents [maxLetters]int8
 	for i := 0; i < 5; i++ {
-		if c.position[i] != 0 {
+		if !use[i] {
 			continue
 		}
-		found := false
-		for j := 0; j < 5; j++ {
-			if c.position[j] != 0 {
+		switch f.tile(i) {
+		case present:
+			if *yellowExcludes {
+				c.notPosition[i][guess[i]-'a'] = true
+			}
+			if *strictGrey {
+				// Every copy of a letter in the answer is marked,
+				// so the tile may mark the same copy as a +,
+				// and repeated ~ tiles don't mean repeated copies.
+				if !correctElsewhere(guess, f, guess[i]) {
+					addContains(c, guess[i], 1)
+				}
 				continue
 			}
-			if answer[j] == guess[i] {
-				found = true
+			presents[guess[i]-'a']++
+			addContains(c, guess[i], presents[guess[i]-'a'])
+		case absent:
+			if *strictGrey {
+				// The answer has no copies of the letter,
+				// whatever the tiles of its other copies.
+				excludeLetter(c, guess[i])
+				continue
 			}
-		}
-		if found {
-			c.notPosition[i][guess[i]-'a'] = true
-			c.contains = append(c.contains, guess[i])
-		} else {
-			for j := 0; j < 5; j++ {
-				if c.position[j] == 0 {
-					c.notPosition[j][guess[i]-'a'] = true
+			if presentElsewhere(guess, f, guess[i]) || unknownElsewhere(guess, use, guess[i]) {
+				// The answer has the letter somewhere else,
+				// just no more copies than were marked present.
+				// Or it may, if another copy's tile is unknown.
+				c.notPosition[i][guess[i]-'a'] = true
+				if !unknownElsewhere(guess, use, guess[i]) {
+					c.exact[guess[i]-'a'] = true
 				}
+				continue
 			}
+			excludeLetter(c, guess[i])
+		}
+	}
+}
+
+// excludeLetter adds constraints to c that b is in no position
+// but those where it is known to be.
+func excludeLetter(c *constraints, b byte) {
+	for j := 0; j < 5; j++ {
+		if c.position[j] == 0 {
+			c.notPosition[j][b-'a'] = true
+		}
+	}
+}
+
+// unknownElsewhere returns whether b is in a position of guess
+// whose tile is unknown: for which use is false.
+func unknownElsewhere(guess string, use [5]bool, b byte) bool {
+	for i := 0; i < 5; i++ {
+		if guess[i] == b && !use[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// correctElsewhere returns whether b is marked correct
+// in any position of guess with the feedback f.
+func correctElsewhere(guess string, f feedback, b byte) bool {
+	for i := 0; i < 5; i++ {
+		if guess[i] == b && f.tile(i) == correct {
+			return true
+		}
+	}
+	return false
+}
+
+// presentElsewhere returns whether b is marked present
+// in any position of guess with the feedback f.
+func presentElsewhere(guess string, f feedback, b byte) bool {
+	for i := 0; i < 5; i++ {
+		if guess[i] == b && f.tile(i) == present {
+			return true
+		}
+	}
+	return false
+}
+
+// feedback is the result of a guess: the color of each of its tiles.
+// It is encoded as a base-3 number, one digit per position,
+// with position 0 in the least-significant digit.
+type feedback uint8
+
+// The digits of a feedback.
+const (
+	absent  = 0 // the letter is not in the answer
+	present = 1 // the letter is in the answer in a different position
+	correct = 2 // the letter is in the correct position
+)
+
+// allCorrect is the feedback for guessing the answer.
+const allCorrect feedback = 242
+
+// pow3 is the value of a feedback digit of 1 at each position.
+var pow3 = [5]feedback{1, 3, 9, 27, 81}
+
+// tile returns the feedback digit for position i.
+func (f feedback) tile(i int) int {
+	return int(f / pow3[i] % 3)
+}
+
+// allPatterns returns every feedback in increasing order:
+// the 3^5 ways to color the tiles of a guess.
+func allPatterns() []feedback {
+	fs := make([]feedback, allCorrect+1)
+	for i := range fs {
+		fs[i] = feedback(i)
+	}
+	return fs
+}
+
+// matches returns whether candidate could be the answer
+// if guessing guess gave the feedback f.
+func (f feedback) matches(guess, candidate string) bool {
+	return computeFeedback(guess, candidate) == f
+}
+
+// computeFeedback returns the feedback for guessing guess
+// when the answer is actually answer.
+//
+// Letters in the correct position are marked first.
+// Then, from left to right, each other letter of the guess is present
+// if the answer has a copy of it not already marked correct or present,
+// and absent otherwise.
+//
+// With -strict-grey, every other letter of the guess is present
+// if the answer has any copy of it, and absent otherwise.
+func computeFeedback(guess string, answer string) feedback {
+	if *strictGrey {
+		return computeStrictGreyFeedback(guess, answer)
+	}
+	var f feedback
+	// unmatched counts the letters of the answer
+	// not yet marked correct or present.
+	var unmatched [maxLetters]int8
+	for i := 0; i < 5; i++ {
+		if guess[i] == answer[i] {
+			f += correct * pow3[i]
+		} else {
+			unmatched[answer[i]-'a']++
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if guess[i] != answer[i] && unmatched[guess[i]-'a'] > 0 {
+			f += present * pow3[i]
+			unmatched[guess[i]-'a']--
+		}
+	}
+	return f
+}
+
+// computeStrictGreyFeedback returns the feedback
+// for guessing guess when the answer is answer, with -strict-grey.
+func computeStrictGreyFeedback(guess string, answer string) feedback {
+	var f feedback
+	for i := 0; i < 5; i++ {
+		switch {
+		case guess[i] == answer[i]:
+			f += correct * pow3[i]
+		case strings.IndexByte(answer, guess[i]) >= 0:
+			f += present * pow3[i]
+		}
+	}
+	return f
+}
+
+// tileSymbols are the symbols for each tile color
+// in feedback entered and printed, indexed by tile.
+var tileSymbols = [3]rune{absent: '-', present: '~', correct: '+'}
+
+// setTileSymbols sets the tileSymbols.
+// Each symbol must be a single character, different from the others.
+func setTileSymbols(absentSym, presentSym, correctSym string) error {
+	var syms [3]rune
+	for tile, sym := range map[int]string{absent: absentSym, present: presentSym, correct: correctSym} {
+		if utf8.RuneCountInString(sym) != 1 || sym == ":" {
+			return fmt.Errorf("feedback symbol %q is not a single character", sym)
+		}
+		syms[tile], _ = utf8.DecodeRuneInString(sym)
+	}
+	if syms[absent] == syms[present] || syms[absent] == syms[correct] || syms[present] == syms[correct] {
+		return fmt.Errorf("feedback symbols %c, %c, and %c are not distinct", syms[absent], syms[present], syms[correct])
+	}
+	tileSymbols = syms
+	return nil
+}
+
+// tileOf returns the tile for the feedback symbol r, or -1 if there is none.
+// The symbols are case-insensitive, like the letters.
+func tileOf(r rune) int {
+	for tile, sym := range tileSymbols {
+		if unicode.ToLower(sym) == unicode.ToLower(r) {
+			return tile
+		}
+	}
+	return -1
+}
+
+// formatFeedback returns the feedback for guess
+// in the format accepted by inputConstraints.
+func formatFeedback(guess string, f feedback) string {
+	var s strings.Builder
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			s.WriteByte(' ')
+		}
+		s.WriteRune(tileSymbols[f.tile(i)])
+		s.WriteRune(decodeLetter(guess[i]))
+	}
+	return s.String()
+}
+
+// formatTiles returns the tile symbols of the feedback f, without letters.
+func formatTiles(f feedback) string {
+	var s strings.Builder
+	for i := 0; i < 5; i++ {
+		s.WriteRune(tileSymbols[f.tile(i)])
+	}
+	return s.String()
+}
+
+// partition returns the candidates, words, grouped by the feedback
+// that guessing guess would give if each were the answer.
+func partition(words []word, guess string) map[feedback][]word {
+	parts := make(map[feedback][]word)
+	for _, w := range words {
+		f := computeFeedback(guess, w.word)
+		parts[f] = append(parts[f], w)
+	}
+	return parts
+}
+
+// feedbackCounts returns the number of the candidates, words,
+// that would give each feedback if it were the answer after guessing guess.
+func feedbackCounts(words []word, guess string) [allCorrect + 1]int {
+	var counts [allCorrect + 1]int
+	for i := range words {
+		counts[computeFeedback(guess, words[i].word)]++
+	}
+	return counts
+}
+
+// expectedSize returns the expected number of candidates remaining
+// after a guess, given the feedback counts of the guess over n candidates.
+// When the feedback partitions the candidates into the same sets
+// as applyDiffConstraint, this equals expectedNextSetSize.
+func expectedSize(counts *[allCorrect + 1]int, n int) float64 {
+	var sum float64
+	for _, c := range counts {
+		sum += float64(c) * float64(c)
+	}
+	return sum / float64(n)
+}
+
+// entropy returns the expected information in bits given by a guess,
+// given the feedback counts of the guess over n candidates.
+func entropy(counts *[allCorrect + 1]int, n int) float64 {
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(n)
+			e -= p * math.Log2(p)
 		}
 	}
+	return e
 }
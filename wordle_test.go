@@ -0,0 +1,608 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testWords returns the candidates from the bundled word list.
+func testWords(t testing.TB) []word {
+	t.Helper()
+	words, err := initialCandidates(freqListPath)
+	if err != nil {
+		t.Fatalf("initialCandidates(%q) failed: %s", freqListPath, err)
+	}
+	return words
+}
+
+// commonWords is the number of most frequent words of the bundled list
+// used as the candidates by TestPlayCommonWords.
+// The whole list has obscure words, like plurals, that take more than 6 guesses.
+const commonWords = 500
+
+// maxAverageGuesses is the most average guesses allowed
+// to find each of the commonWords.
+const maxAverageGuesses = 3.1
+
+func TestPlayCommonWords(t *testing.T) {
+	// initialCandidates sorts the words most frequent first.
+	words := testWords(t)[:commonWords]
+	// Sort the first guess once, instead of for every game.
+	first := nextGuess(append([]word(nil), words...), 0, "", "")
+	ws := make([]word, len(words))
+	var total int
+	for _, w := range words {
+		copy(ws, words)
+		n, pass := play(ws, first, w.word)
+		if !pass {
+			t.Errorf("play(%s) took more than %d guesses", decodeWord(w.word), *maxGuesses)
+		}
+		total += n
+	}
+	if avg := float64(total) / float64(len(words)); avg > maxAverageGuesses {
+		t.Errorf("average guesses is %.4f, want at most %.4f", avg, maxAverageGuesses)
+	}
+}
+
+func TestComputeFeedback(t *testing.T) {
+	tests := []struct {
+		guess, answer string
+		want          string
+	}{
+		{"allee", "eagle", "~a ~l -l ~e +e"},
+		{"geese", "these", "-g -e +e +s +e"},
+		{"robot", "motor", "~r +o -b +o ~t"},
+		{"crane", "crane", "+c +r +a +n +e"},
+		{"eerie", "there", "~e -e ~r -i +e"},
+	}
+	for _, test := range tests {
+		f := computeFeedback(test.guess, test.answer)
+		if got := formatFeedback(test.guess, f); got != test.want {
+			t.Errorf("computeFeedback(%s, %s)=%q, want %q", test.guess, test.answer, got, test.want)
+		}
+	}
+}
+
+func TestPartitionSizes(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	for _, guess := range []string{"cares", "fuzzy", words[0].word} {
+		n := 0
+		for f, part := range partition(words, guess) {
+			for _, w := range part {
+				if got := computeFeedback(guess, w.word); got != f {
+					t.Errorf("partition(%s) has %s under %s, but its feedback is %s",
+						guess, decodeWord(w.word), formatFeedback(guess, f), formatFeedback(guess, got))
+				}
+			}
+			n += len(part)
+		}
+		if n != len(words) {
+			t.Errorf("partition(%s) sizes sum to %d, want %d", guess, n, len(words))
+		}
+	}
+}
+
+// writeTestFile writes data to a new file in a temporary directory
+// and returns its path.
+func writeTestFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "freq.txt")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+	return path
+}
+
+func TestReadFreqFileMalformedLines(t *testing.T) {
+	path := writeTestFile(t, "hello 5\n\nworld\n  \nthree 7\nabc 3\nx\nfifty five\n")
+	freq := make(map[string]int)
+	var stats freqStats
+	if err := readFreqFile(path, 1, freq, &stats); err != nil {
+		t.Fatalf("readFreqFile failed: %s", err)
+	}
+	if want := map[string]int{"hello": 5, "three": 7}; !reflect.DeepEqual(freq, want) {
+		t.Errorf("readFreqFile read %v, want %v", freq, want)
+	}
+	want := freqStats{lines: 8, kept: 2, blank: 2, noFreq: 2, wrongLength: 1, badFreq: 1}
+	if stats != want {
+		t.Errorf("readFreqFile stats are %+v, want %+v", stats, want)
+	}
+}
+
+func TestInitialCandidatesDuplicates(t *testing.T) {
+	path := writeTestFile(t, "hello 5\nworld 3\nhello 2\n")
+	words, err := initialCandidates(path)
+	if err != nil {
+		t.Fatalf("initialCandidates failed: %s", err)
+	}
+	var got []string
+	for _, w := range words {
+		got = append(got, fmt.Sprintf("%s %d", decodeWord(w.word), w.freq))
+	}
+	if want := []string{"hello 7", "world 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("initialCandidates read %v, want %v", got, want)
+	}
+}
+
+// benchmarkConstraints returns the bundled candidates and the constraints
+// from guessing cares when the answer is three.
+func benchmarkConstraints(b *testing.B) ([]word, *constraints) {
+	words := testWords(b)
+	c := newConstraints()
+	applyDiffConstraint(c, "cares", "three")
+	b.ResetTimer()
+	return words, c
+}
+
+// satisfiesString is like satisfiesLetters, but indexes the word string,
+// as satisfies did before candidates had letters arrays.
+// It is the reference for BenchmarkSatisfiesString.
+func satisfiesString(c *constraints, word string) bool {
+	for i := 0; i < 5; i++ {
+		got := word[i]
+		if want := c.position[i]; want != 0 {
+			if got != want {
+				return false
+			}
+		} else {
+			if c.notPosition[i][got-'a'] {
+				return false
+			}
+		}
+	}
+	for _, b := range c.contains {
+		var n int8
+		for i := 0; i < 5; i++ {
+			if c.position[i] == 0 && word[i] == b {
+				n++
+			}
+		}
+		if n < c.count[b-'a'] || c.exact[b-'a'] && n > c.count[b-'a'] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSatisfiesString(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	c := newConstraints()
+	for _, g := range []string{"cares", "sassy", "eerie"} {
+		for _, a := range words {
+			clearConstraints(c)
+			applyDiffConstraint(c, g, a.word)
+			for i := range words {
+				if got, want := satisfiesString(c, words[i].word), satisfiesLetters(c, &words[i].letters); got != want {
+					t.Fatalf("guess %s, answer %s: satisfiesString(%s)=%v, satisfiesLetters=%v",
+						g, decodeWord(a.word), decodeWord(words[i].word), got, want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkSatisfiesString checks the candidates by their strings.
+func BenchmarkSatisfiesString(b *testing.B) {
+	words, c := benchmarkConstraints(b)
+	for i := 0; i < b.N; i++ {
+		for j := range words {
+			satisfiesString(c, words[j].word)
+		}
+	}
+}
+
+// BenchmarkSatisfiesLetters checks the candidates by their letters arrays,
+// as filter does.
+func BenchmarkSatisfiesLetters(b *testing.B) {
+	words, c := benchmarkConstraints(b)
+	for i := 0; i < b.N; i++ {
+		for j := range words {
+			satisfiesLetters(c, &words[j].letters)
+		}
+	}
+}
+
+func TestOpeners(t *testing.T) {
+	// want is the opener for each -score mode among the commonWords;
+	// if a change to scoring changes one, check and update it.
+	want := map[string]string{
+		"exp":            "stare",
+		"composite":      "raise",
+		"coverage":       "tears",
+		"blended":        "mores",
+		"info-positions": "boree",
+		"guesses":        "stare",
+		"entropy":        "stare",
+		"minimax":        "raise",
+	}
+	words := testWords(t)[:commonWords]
+	mode := *scoreMode
+	defer func() { *scoreMode = mode }()
+	for _, m := range scoreModes {
+		*scoreMode = m
+		got := decodeWord(nextGuess(append([]word(nil), words...), 0, "", ""))
+		if got != want[m] {
+			t.Errorf("-score %s opens with %s, want %s", m, got, want[m])
+		}
+	}
+}
+
+func TestSatisfiesRepeatedLetters(t *testing.T) {
+	tests := []struct {
+		guess, answer, word string
+		want                bool
+	}{
+		// +t ~e -p -e +e: two es, one green and one elsewhere.
+		{"tepee", "there", "there", true},
+		{"tepee", "there", "these", true},
+		{"tepee", "there", "thyme", false},
+		{"tepee", "there", "terse", false},
+		// +e -a -g -l +e: a green e satisfies the e it marks.
+		{"eagle", "eerie", "eerie", true},
+		{"eagle", "eerie", "emcee", true},
+		{"eagle", "eerie", "erred", false},
+		// -s -p ~e -e ~d: exactly one e, not in either guessed position.
+		{"speed", "abide", "abide", true},
+		{"speed", "abide", "oxide", true},
+		{"speed", "abide", "dense", false},
+		{"speed", "abide", "evade", false},
+	}
+	for _, test := range tests {
+		c := newConstraints()
+		applyDiffConstraint(c, test.guess, test.answer)
+		if got := satisfies(c, test.word); got != test.want {
+			t.Errorf("guess %s, answer %s: satisfies(%s)=%v, want %v",
+				test.guess, test.answer, test.word, got, test.want)
+		}
+	}
+}
+
+func TestInputConstraints(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"-c ~r +a -n",
+		"-c ~r +a -n -e -s",
+		"-c ~r +ab -n -e",
+		"-c ~r *a -n -e",
+		"-c ~r +1 -n -e",
+		"-c ~r +A: -n -e",
+	} {
+		if c := inputConstraints(line); c != nil {
+			t.Errorf("inputConstraints(%q)=%v, want nil", line, c)
+		}
+	}
+
+	want := newConstraints()
+	want.position[2] = 'a'
+	want.contains = []byte{'r'}
+	want.count['r'-'a'] = 1
+	want.notPosition[1]['r'-'a'] = true
+	for _, b := range "cne" {
+		for _, i := range []int{0, 1, 3, 4} {
+			want.notPosition[i][b-'a'] = true
+		}
+	}
+	// Letters are case-insensitive, and fields may be separated by any spaces.
+	for _, line := range []string{"-c ~r +a -n -e", " -C  ~r +A -n -e "} {
+		if got := inputConstraints(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("inputConstraints(%q)=%v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestExactCount(t *testing.T) {
+	tests := []struct {
+		guess, answer string
+		// yes satisfy the constraints, and no don't.
+		yes, no []string
+	}{
+		// +s +a -s -s +y: exactly one s.
+		{"sassy", "salty", []string{"salty", "sally", "saucy"}, []string{"sassy", "salsa", "sasty"}},
+		// -s -w -i +s +s: exactly two s.
+		{"swiss", "class", []string{"class", "bless", "gloss"}, []string{"asass", "oasss"}},
+		// ~s -w -i +s -s: exactly two s, one not first or last.
+		{"swiss", "bossy", []string{"bossy", "fussy", "gassy"}, []string{"sassy", "bosss", "boosy"}},
+	}
+	for _, test := range tests {
+		c := newConstraints()
+		applyDiffConstraint(c, test.guess, test.answer)
+		for _, w := range test.yes {
+			if !satisfies(c, w) {
+				t.Errorf("guess %s, answer %s: satisfies(%s)=false, want true", test.guess, test.answer, w)
+			}
+		}
+		for _, w := range test.no {
+			if satisfies(c, w) {
+				t.Errorf("guess %s, answer %s: satisfies(%s)=true, want false", test.guess, test.answer, w)
+			}
+		}
+	}
+}
+
+// TestSelfcheck checks the -selfcheck invariant for every pair of the commonWords:
+// the answer satisfies the constraints from guessing guess.
+func TestSelfcheck(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	grey := *strictGrey
+	defer func() { *strictGrey = grey }()
+	for _, strict := range []bool{false, true} {
+		*strictGrey = strict
+		c := newConstraints()
+		for _, g := range words {
+			for _, a := range words {
+				clearConstraints(c)
+				applyDiffConstraint(c, g.word, a.word)
+				if !satisfies(c, a.word) {
+					t.Fatalf("-strict-grey=%v: guess %s, answer %s: answer does not satisfy %s",
+						strict, decodeWord(g.word), decodeWord(a.word), c.compact())
+				}
+			}
+		}
+	}
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestPlayAnswersNotInList(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	first := *guess0
+	defer func() { *guess0 = first }()
+	*guess0 = "cares"
+	got := captureStdout(t, func() { playAnswers(words, []string{"zzzzz", "there"}) })
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("playAnswers printed %q, want 3 lines", got)
+	}
+	if want := "zzzzz: " + notInList; lines[0] != want {
+		t.Errorf("playAnswers printed %q for zzzzz, want %q", lines[0], want)
+	}
+	if !strings.HasPrefix(lines[1], "there: passed in ") {
+		t.Errorf("playAnswers printed %q for there, want it passed", lines[1])
+	}
+	// The answer that is not in the list is not counted as a game.
+	if !strings.HasPrefix(lines[2], "solved 1 of 1,") {
+		t.Errorf("playAnswers summary is %q, want solved 1 of 1", lines[2])
+	}
+}
+
+func TestFilterKeepsOrderAndFields(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	for i := range words {
+		words[i].score = i
+		words[i].exp = float64(i) / 2
+	}
+	c := newConstraints()
+	applyDiffConstraint(c, "cares", "three")
+	var want []word
+	for _, w := range words {
+		if satisfies(c, w.word) {
+			want = append(want, w)
+		}
+	}
+	if len(want) == 0 {
+		t.Fatalf("no words satisfy %s", c.compact())
+	}
+	got := filter(c, append([]word(nil), words...))
+	if len(got) != len(want) {
+		t.Errorf("filter returned %d words, want %d", len(got), len(want))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filter returned %v, want %v", got, want)
+	}
+}
+
+func TestReadFreqFileOneColumn(t *testing.T) {
+	tests := []struct {
+		data   string
+		noFreq bool
+		want   map[string]int
+	}{
+		// A plain word list gives each word frequency 1.
+		{"hello\nworld\nthree\n", false, map[string]int{"hello": 1, "world": 1, "three": 1}},
+		{"hello\n\nworld\nabc\n", false, map[string]int{"hello": 1, "world": 1}},
+		// A single line with a frequency makes it not a plain word list.
+		{"hello\nworld 3\n", false, map[string]int{"world": 3}},
+		// -nofreq-file ignores the frequencies.
+		{"hello 5\nworld 3\n", true, map[string]int{"hello": 1, "world": 1}},
+	}
+	noFreq := *noFreqFile
+	defer func() { *noFreqFile = noFreq }()
+	for _, test := range tests {
+		*noFreqFile = test.noFreq
+		path := writeTestFile(t, test.data)
+		freq := make(map[string]int)
+		if err := readFreqFile(path, 1, freq, nil); err != nil {
+			t.Fatalf("readFreqFile(%q) failed: %s", test.data, err)
+		}
+		if !reflect.DeepEqual(freq, test.want) {
+			t.Errorf("-nofreq-file=%v: readFreqFile(%q) read %v, want %v", test.noFreq, test.data, freq, test.want)
+		}
+	}
+}
+
+func TestReadFreqFileComments(t *testing.T) {
+	data := "# My curated list.\nword,count\n#cares 9\nhello,5 # common\n  # indented\nworld,3#rare\n"
+	path := writeTestFile(t, data)
+	freq := make(map[string]int)
+	var stats freqStats
+	if err := readFreqFile(path, 1, freq, &stats); err != nil {
+		t.Fatalf("readFreqFile failed: %s", err)
+	}
+	if want := map[string]int{"hello": 5, "world": 3}; !reflect.DeepEqual(freq, want) {
+		t.Errorf("readFreqFile read %v, want %v", freq, want)
+	}
+	// The header is detected after the leading comment.
+	want := freqStats{lines: 6, comments: 3, header: 1, kept: 2}
+	if stats != want {
+		t.Errorf("readFreqFile stats are %+v, want %+v", stats, want)
+	}
+}
+
+// TestPlayHardAnswers checks that answers that are hard to find,
+// because many candidates differ from them by a single letter,
+// are found within 6 guesses from the default opener
+// with all of the bundled candidates.
+func TestPlayHardAnswers(t *testing.T) {
+	words := testWords(t)
+	first := nextGuess(append([]word(nil), words...), 0, "", "")
+	ws := make([]word, len(words))
+	for _, answer := range []string{"hatch", "patch", "fuzzy"} {
+		if !hasWord(words, answer) {
+			t.Fatalf("%s is not in %s", answer, freqListPath)
+		}
+		copy(ws, words)
+		if n, pass := play(ws, first, answer); !pass || n > 6 {
+			t.Errorf("play(%s) took %d guesses, want at most 6", answer, n)
+		}
+	}
+}
+
+func TestAllPatterns(t *testing.T) {
+	fs := allPatterns()
+	if len(fs) != 243 {
+		t.Fatalf("allPatterns returned %d patterns, want 243", len(fs))
+	}
+	seen := make(map[string]bool)
+	for _, f := range fs {
+		tiles := formatTiles(f)
+		if seen[tiles] {
+			t.Errorf("allPatterns has %s more than once", tiles)
+		}
+		seen[tiles] = true
+	}
+}
+
+func TestMatches(t *testing.T) {
+	words := testWords(t)[:commonWords]
+	for _, guess := range []string{"cares", "eerie", "sassy"} {
+		for _, w := range words {
+			n := 0
+			for _, f := range allPatterns() {
+				got := f.matches(guess, w.word)
+				if want := computeFeedback(guess, w.word) == f; got != want {
+					t.Errorf("(%s).matches(%s, %s)=%v, want %v", formatTiles(f), guess, decodeWord(w.word), got, want)
+				}
+				if got {
+					n++
+				}
+			}
+			if n != 1 {
+				t.Errorf("%d patterns match guess %s for %s, want 1", n, guess, decodeWord(w.word))
+			}
+		}
+	}
+}
+
+// TestPlayLenientYellow checks that, without -yellow-excludes-position,
+// a wrong guess that satisfies its own feedback is not guessed again.
+func TestPlayLenientYellow(t *testing.T) {
+	yellow := *yellowExcludes
+	defer func() { *yellowExcludes = yellow }()
+	*yellowExcludes = false
+	var words []word
+	for _, w := range []string{"alter", "alert", "later"} {
+		words = append(words, newWord(w, 1))
+	}
+	tests := []struct {
+		first, answer string
+		want          int
+	}{
+		// ~l ~a +t +e +r is satisfied by later itself.
+		{"later", "alter", 2},
+		{"alter", "later", 2},
+	}
+	for _, test := range tests {
+		ws := append([]word(nil), words...)
+		if n, pass := play(ws, test.first, test.answer); !pass || n != test.want {
+			t.Errorf("play(first=%s, %s)=%d, %v, want %d, true", test.first, test.answer, n, pass, test.want)
+		}
+	}
+}
+
+func TestInitialCandidatesEmpty(t *testing.T) {
+	min := *minFreq
+	defer func() { *minFreq = min }()
+	tests := []struct {
+		data    string
+		minFreq int
+	}{
+		{"abc 3\nfifty five\n", 0},
+		{"# only a comment\n", 0},
+		{"hello 5\nworld 3\n", 10},
+	}
+	for _, test := range tests {
+		*minFreq = test.minFreq
+		path := writeTestFile(t, test.data)
+		if words, err := initialCandidates(path); err == nil {
+			t.Errorf("-minfreq %d: initialCandidates(%q) returned %d words, want an error",
+				test.minFreq, test.data, len(words))
+		}
+	}
+}
+
+func TestDiverseWords(t *testing.T) {
+	tests := []struct {
+		// words are in increasing order of preference.
+		words []string
+		n     int
+		want  []string
+	}{
+		// The top word is first even if it repeats letters.
+		{[]string{"abcde", "fghij", "geese"}, 1, []string{"geese"}},
+		{[]string{"abcde", "fghij", "geese"}, 2, []string{"fghij", "geese"}},
+		{[]string{"abcde", "fghij", "geese"}, 3, []string{"abcde", "fghij", "geese"}},
+		// geeks adds fewer new letters to cares than fight does.
+		{[]string{"fight", "geeks", "cares"}, 2, []string{"fight", "cares"}},
+	}
+	for _, test := range tests {
+		var words []word
+		for _, w := range test.words {
+			words = append(words, newWord(w, 1))
+		}
+		var got []string
+		for _, w := range diverseWords(words, test.n) {
+			got = append(got, w.word)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("diverseWords(%v, %d)=%v, want %v", test.words, test.n, got, test.want)
+		}
+	}
+}
+
+func TestBestGuess(t *testing.T) {
+	if w, err := bestGuess(nil); err == nil {
+		t.Errorf("bestGuess(nil)=%s, want an error", decodeWord(w))
+	}
+	words := testWords(t)[:commonWords]
+	want := nextGuess(append([]word(nil), words...), 0, "", "")
+	got, err := bestGuess(words)
+	if err != nil {
+		t.Fatalf("bestGuess failed: %s", err)
+	}
+	if got != want {
+		t.Errorf("bestGuess=%s, want %s", decodeWord(got), decodeWord(want))
+	}
+}